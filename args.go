@@ -0,0 +1,300 @@
+package godbot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ArgType is the type an argument is converted to before the handler runs.
+type ArgType int
+
+// Argument types, the zero value keeps the argument as a string.
+const (
+	ArgString   ArgType = iota
+	ArgInt              // Whole number.
+	ArgDuration         // Go duration such as 1h30m, "d" may be used for days.
+	ArgBool             // true/false, yes/no, on/off.
+	ArgUser             // Mention, ID or Username#Discriminator.
+	ArgChannel          // Mention or ID of a channel.
+	ArgRole             // Mention, ID or name of a role in the guild.
+)
+
+// String returns the name shown in usage lines.
+func (t ArgType) String() string {
+	switch t {
+	case ArgInt:
+		return "number"
+	case ArgDuration:
+		return "duration"
+	case ArgBool:
+		return "yes/no"
+	case ArgUser:
+		return "user"
+	case ArgChannel:
+		return "channel"
+	case ArgRole:
+		return "role"
+	}
+	return "text"
+}
+
+// Argument conversion errors.
+var (
+	errArgInt      = errors.New("expected a whole number")
+	errArgDuration = errors.New("expected a duration such as 10m, 1h30m or 2d")
+	errArgBool     = errors.New("expected yes or no")
+	errArgUser     = errors.New("expected a user mention, ID or Username#Discriminator")
+	errArgChannel  = errors.New("expected a channel mention or ID")
+	errArgRole     = errors.New("expected a role mention, ID or name")
+	errArgGuild    = errors.New("can only be used in a server")
+	errArgAmbig    = errors.New("more than one role has that name, use a mention or ID")
+)
+
+// UsageError is replied to the invoker, along with the command's usage line,
+// when arguments are missing or cannot be converted.
+type UsageError struct {
+	Arg string // Name of the argument.
+	Err error
+}
+
+func (e *UsageError) Error() string {
+	if e.Err == ErrMissingArgs {
+		return fmt.Sprintf("missing argument %s", e.Arg)
+	}
+	return fmt.Sprintf("invalid %s: %v", e.Arg, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+// convertArgs converts the parsed arguments to the types of their specs.
+func (cmd *Command) convertArgs(ctx *Context) error {
+	ctx.values = make(map[string]interface{}, len(cmd.Args))
+	for n, spec := range cmd.Args {
+		if n >= len(ctx.Args) {
+			if !spec.Optional {
+				return &UsageError{Arg: spec.Name, Err: ErrMissingArgs}
+			}
+			continue
+		}
+
+		v, err := convertArg(ctx, spec.Type, ctx.Args[n])
+		if err != nil {
+			return &UsageError{Arg: spec.Name, Err: err}
+		}
+		ctx.values[spec.Name] = v
+	}
+	return nil
+}
+
+func convertArg(ctx *Context, t ArgType, raw string) (interface{}, error) {
+	switch t {
+	case ArgInt:
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errArgInt
+		}
+		return v, nil
+	case ArgDuration:
+		return parseDuration(raw)
+	case ArgBool:
+		return parseBool(raw)
+	case ArgUser:
+		return ctx.resolveUser(raw)
+	case ArgChannel:
+		return ctx.resolveChannel(raw)
+	case ArgRole:
+		return ctx.resolveRole(raw)
+	}
+	return raw, nil
+}
+
+// parseDuration extends time.ParseDuration with whole days, such as 2d.
+func parseDuration(raw string) (time.Duration, error) {
+	if strings.HasSuffix(raw, "d") {
+		days, err := strconv.Atoi(raw[:len(raw)-1])
+		if err != nil || days < 0 {
+			return 0, errArgDuration
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return 0, errArgDuration
+	}
+	return d, nil
+}
+
+func parseBool(raw string) (bool, error) {
+	switch strings.ToLower(raw) {
+	case "true", "yes", "y", "on", "1":
+		return true, nil
+	case "false", "no", "n", "off", "0":
+		return false, nil
+	}
+	return false, errArgBool
+}
+
+// mentionID strips the mention syntax <prefix ID> around an ID. Plain IDs are
+// returned as is, anything else is not an ID.
+func mentionID(raw string, prefixes ...string) (string, bool) {
+	if strings.HasPrefix(raw, "<") && strings.HasSuffix(raw, ">") {
+		inner := raw[1 : len(raw)-1]
+		for _, p := range prefixes {
+			if strings.HasPrefix(inner, p) && isSnowflake(inner[len(p):]) {
+				return inner[len(p):], true
+			}
+		}
+		return "", false
+	}
+	return raw, isSnowflake(raw)
+}
+
+func isSnowflake(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+// tagLookupLimit caps the members fetched from discord to resolve a tag typed
+// as a command argument.
+const tagLookupLimit = 2 * memberPageSize
+
+// resolveUser finds a user from a mention, ID or Username#Discriminator. Tags
+// are looked up like UserID, starting with the invoking guild. Anyone can type
+// a tag, so at most tagLookupLimit members are fetched from discord for it.
+func (ctx *Context) resolveUser(raw string) (*discordgo.User, error) {
+	if id, ok := mentionID(raw, "@!", "@"); ok {
+		if ctx.Guild != nil {
+			if m, ok := ctx.Core.Cache.Member(ctx.Guild.ID, id); ok {
+				return m.User, nil
+			}
+		}
+		u, err := ctx.Session.User(id)
+		if err != nil {
+			return nil, errArgUser
+		}
+		return u, nil
+	}
+
+	if _, _, err := splitTag(raw); err != nil {
+		return nil, errArgUser
+	}
+
+	var gID string
+	if ctx.Guild != nil {
+		gID = ctx.Guild.ID
+	}
+	budget := tagLookupLimit
+	m, err := ctx.Core.memberByTagAnyGuild(raw, gID, &budget)
+	if err == ErrNotFound {
+		return nil, fmt.Errorf("no user named %s", raw)
+	} else if err != nil {
+		return nil, errArgUser
+	}
+	return m.User, nil
+}
+
+// resolveChannel finds a channel from a mention or ID. Used in a guild, the
+// channel must belong to it.
+func (ctx *Context) resolveChannel(raw string) (*discordgo.Channel, error) {
+	id, ok := mentionID(raw, "#")
+	if !ok {
+		return nil, errArgChannel
+	}
+
+	var channel *discordgo.Channel
+	if c := ctx.Core.GetChannel(id); c != nil {
+		channel = c.Channel
+	} else if c, err := ctx.Session.Channel(id); err == nil {
+		channel = c
+	} else {
+		return nil, errArgChannel
+	}
+
+	if ctx.Guild != nil && channel.GuildID != ctx.Guild.ID {
+		return nil, errors.New("channel is not in this server")
+	}
+	return channel, nil
+}
+
+// resolveRole finds a role of the invoking guild from a mention, ID or name.
+func (ctx *Context) resolveRole(raw string) (*discordgo.Role, error) {
+	if ctx.Guild == nil {
+		return nil, errArgGuild
+	}
+
+	if id, ok := mentionID(raw, "@&"); ok {
+		if r := ctx.Core.GetRole(ctx.Guild.ID, id); r != nil {
+			return r, nil
+		}
+		return nil, errArgRole
+	}
+
+	roles := ctx.Core.RolesByName(ctx.Guild.ID, raw)
+	switch len(roles) {
+	case 0:
+		return nil, errArgRole
+	case 1:
+		return roles[0], nil
+	}
+	return nil, errArgAmbig
+}
+
+// HasArg checks if an argument was given.
+func (ctx *Context) HasArg(name string) bool {
+	_, ok := ctx.values[name]
+	return ok
+}
+
+// ArgString returns a text argument, or "" if it was not given.
+func (ctx *Context) ArgString(name string) string {
+	v, _ := ctx.values[name].(string)
+	return v
+}
+
+// ArgInt returns a number argument, or 0 if it was not given.
+func (ctx *Context) ArgInt(name string) int {
+	v, _ := ctx.values[name].(int)
+	return v
+}
+
+// ArgDuration returns a duration argument, or 0 if it was not given.
+func (ctx *Context) ArgDuration(name string) time.Duration {
+	v, _ := ctx.values[name].(time.Duration)
+	return v
+}
+
+// ArgBool returns a yes/no argument, or false if it was not given.
+func (ctx *Context) ArgBool(name string) bool {
+	v, _ := ctx.values[name].(bool)
+	return v
+}
+
+// ArgUser returns a user argument, or nil if it was not given.
+func (ctx *Context) ArgUser(name string) *discordgo.User {
+	v, _ := ctx.values[name].(*discordgo.User)
+	return v
+}
+
+// ArgChannel returns a channel argument, or nil if it was not given.
+func (ctx *Context) ArgChannel(name string) *discordgo.Channel {
+	v, _ := ctx.values[name].(*discordgo.Channel)
+	return v
+}
+
+// ArgRole returns a role argument, or nil if it was not given.
+func (ctx *Context) ArgRole(name string) *discordgo.Role {
+	v, _ := ctx.values[name].(*discordgo.Role)
+	return v
+}
@@ -0,0 +1,365 @@
+package godbot
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Cache stores the guilds, channels, roles and members known to the bot.
+// Implementations must be safe for concurrent use. Returned slices are
+// snapshots owned by the caller, the structures they point to are shared and
+// must not be modified.
+type Cache interface {
+	// Guild returns the guild with the ID.
+	Guild(gID string) (*discordgo.Guild, bool)
+	// Guilds returns every guild, ordered by ID.
+	Guilds() []*discordgo.Guild
+	// SetGuild adds or replaces a guild. Roles, channels and members carried
+	// by the guild are indexed as well.
+	SetGuild(guild *discordgo.Guild)
+	// DeleteGuild removes a guild with its channels, roles and members.
+	DeleteGuild(gID string)
+
+	// Channel returns the guild or private channel with the ID.
+	Channel(cID string) (*discordgo.Channel, bool)
+	// Channels returns every guild channel, ordered by ID.
+	Channels() []*discordgo.Channel
+	// GuildChannels returns the channels of a guild, ordered by position.
+	GuildChannels(gID string) []*discordgo.Channel
+	// PrivateChannels returns every direct and group message channel.
+	PrivateChannels() []*discordgo.Channel
+	// SetChannel adds or replaces a channel.
+	SetChannel(channel *discordgo.Channel)
+	// DeleteChannel removes a channel.
+	DeleteChannel(cID string)
+
+	// Role returns the role with the ID in a guild.
+	Role(gID, rID string) (*discordgo.Role, bool)
+	// Roles returns the roles of a guild, ordered by ID.
+	Roles(gID string) []*discordgo.Role
+	// SetRole adds or replaces a role in a guild.
+	SetRole(gID string, role *discordgo.Role)
+	// DeleteRole removes a role from a guild.
+	DeleteRole(gID, rID string)
+
+	// Member returns the member of a guild with the user ID.
+	Member(gID, uID string) (*discordgo.Member, bool)
+	// Members returns the members of a guild, ordered by user ID.
+	Members(gID string) []*discordgo.Member
+	// SetMember adds or replaces a member of a guild.
+	SetMember(gID string, member *discordgo.Member)
+	// DeleteMember removes a member from a guild.
+	DeleteMember(gID, uID string)
+}
+
+// MemoryCache is the default Cache, it keeps everything in ID indexed maps
+// guarded by a RWMutex. It stores shallow copies of what it is given, the
+// payloads stay owned by discordgo's State, which updates them in place.
+type MemoryCache struct {
+	mu       sync.RWMutex
+	guilds   map[string]*discordgo.Guild
+	channels map[string]*discordgo.Channel
+	links    map[string]map[string]*discordgo.Channel // [guild ID] channels
+	private  map[string]*discordgo.Channel
+	roles    map[string]map[string]*discordgo.Role   // [guild ID] roles
+	members  map[string]map[string]*discordgo.Member // [guild ID] members
+}
+
+// NewMemoryCache creates an empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		guilds:   make(map[string]*discordgo.Guild),
+		channels: make(map[string]*discordgo.Channel),
+		links:    make(map[string]map[string]*discordgo.Channel),
+		private:  make(map[string]*discordgo.Channel),
+		roles:    make(map[string]map[string]*discordgo.Role),
+		members:  make(map[string]map[string]*discordgo.Member),
+	}
+}
+
+// Guild returns the guild with the ID.
+func (c *MemoryCache) Guild(gID string) (*discordgo.Guild, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	g, ok := c.guilds[gID]
+	return g, ok
+}
+
+// Guilds returns every guild, ordered by ID.
+func (c *MemoryCache) Guilds() []*discordgo.Guild {
+	c.mu.RLock()
+	guilds := make([]*discordgo.Guild, 0, len(c.guilds))
+	for _, g := range c.guilds {
+		guilds = append(guilds, g)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(guilds, func(i, j int) bool { return idLess(guilds[i].ID, guilds[j].ID) })
+	return guilds
+}
+
+// SetGuild adds or replaces a guild, indexing the roles, channels and members
+// it carries.
+func (c *MemoryCache) SetGuild(guild *discordgo.Guild) {
+	g := copyGuild(guild)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.guilds[g.ID] = g
+	if len(g.Roles) > 0 {
+		roles := make(map[string]*discordgo.Role, len(g.Roles))
+		for _, r := range g.Roles {
+			roles[r.ID] = r
+		}
+		c.roles[g.ID] = roles
+	}
+
+	for _, ch := range g.Channels {
+		c.setChannel(ch)
+	}
+	for _, m := range g.Members {
+		c.setMember(g.ID, m)
+	}
+}
+
+// copyGuild copies a guild with its roles, channels and members. Channels and
+// members in a guild payload do not carry their guild ID, the copies do.
+func copyGuild(guild *discordgo.Guild) *discordgo.Guild {
+	g := *guild
+	if guild.Roles != nil {
+		g.Roles = make([]*discordgo.Role, len(guild.Roles))
+		for n, r := range guild.Roles {
+			g.Roles[n] = copyRole(r)
+		}
+	}
+	if guild.Channels != nil {
+		g.Channels = make([]*discordgo.Channel, len(guild.Channels))
+		for n, ch := range guild.Channels {
+			g.Channels[n] = copyChannel(ch)
+			g.Channels[n].GuildID = guild.ID
+		}
+	}
+	if guild.Members != nil {
+		g.Members = make([]*discordgo.Member, len(guild.Members))
+		for n, m := range guild.Members {
+			g.Members[n] = copyMember(m)
+			g.Members[n].GuildID = guild.ID
+		}
+	}
+	return &g
+}
+
+func copyChannel(channel *discordgo.Channel) *discordgo.Channel {
+	ch := *channel
+	return &ch
+}
+
+func copyRole(role *discordgo.Role) *discordgo.Role {
+	r := *role
+	return &r
+}
+
+func copyMember(member *discordgo.Member) *discordgo.Member {
+	m := *member
+	return &m
+}
+
+// DeleteGuild removes a guild with its channels, roles and members.
+func (c *MemoryCache) DeleteGuild(gID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for cID := range c.links[gID] {
+		delete(c.channels, cID)
+	}
+	delete(c.links, gID)
+	delete(c.roles, gID)
+	delete(c.members, gID)
+	delete(c.guilds, gID)
+}
+
+// Channel returns the guild or private channel with the ID.
+func (c *MemoryCache) Channel(cID string) (*discordgo.Channel, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ch, ok := c.channels[cID]
+	return ch, ok
+}
+
+// Channels returns every guild channel, ordered by ID.
+func (c *MemoryCache) Channels() []*discordgo.Channel {
+	c.mu.RLock()
+	channels := make([]*discordgo.Channel, 0, len(c.channels))
+	for _, ch := range c.channels {
+		if !isPrivate(ch) {
+			channels = append(channels, ch)
+		}
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(channels, func(i, j int) bool { return idLess(channels[i].ID, channels[j].ID) })
+	return channels
+}
+
+// GuildChannels returns the channels of a guild, ordered by position.
+func (c *MemoryCache) GuildChannels(gID string) []*discordgo.Channel {
+	c.mu.RLock()
+	channels := make([]*discordgo.Channel, 0, len(c.links[gID]))
+	for _, ch := range c.links[gID] {
+		channels = append(channels, ch)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].Position != channels[j].Position {
+			return channels[i].Position < channels[j].Position
+		}
+		return idLess(channels[i].ID, channels[j].ID)
+	})
+	return channels
+}
+
+// PrivateChannels returns every direct and group message channel.
+func (c *MemoryCache) PrivateChannels() []*discordgo.Channel {
+	c.mu.RLock()
+	channels := make([]*discordgo.Channel, 0, len(c.private))
+	for _, ch := range c.private {
+		channels = append(channels, ch)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(channels, func(i, j int) bool { return idLess(channels[i].ID, channels[j].ID) })
+	return channels
+}
+
+// SetChannel adds or replaces a channel.
+func (c *MemoryCache) SetChannel(channel *discordgo.Channel) {
+	ch := copyChannel(channel)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setChannel(ch)
+}
+
+func (c *MemoryCache) setChannel(channel *discordgo.Channel) {
+	c.channels[channel.ID] = channel
+	if isPrivate(channel) {
+		c.private[channel.ID] = channel
+		return
+	}
+
+	if c.links[channel.GuildID] == nil {
+		c.links[channel.GuildID] = make(map[string]*discordgo.Channel)
+	}
+	c.links[channel.GuildID][channel.ID] = channel
+}
+
+// DeleteChannel removes a channel.
+func (c *MemoryCache) DeleteChannel(cID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, ok := c.channels[cID]
+	if !ok {
+		return
+	}
+	delete(c.channels, cID)
+	delete(c.private, cID)
+	delete(c.links[ch.GuildID], cID)
+}
+
+// Role returns the role with the ID in a guild.
+func (c *MemoryCache) Role(gID, rID string) (*discordgo.Role, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r, ok := c.roles[gID][rID]
+	return r, ok
+}
+
+// Roles returns the roles of a guild, ordered by ID.
+func (c *MemoryCache) Roles(gID string) []*discordgo.Role {
+	c.mu.RLock()
+	roles := make([]*discordgo.Role, 0, len(c.roles[gID]))
+	for _, r := range c.roles[gID] {
+		roles = append(roles, r)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(roles, func(i, j int) bool { return idLess(roles[i].ID, roles[j].ID) })
+	return roles
+}
+
+// SetRole adds or replaces a role in a guild.
+func (c *MemoryCache) SetRole(gID string, role *discordgo.Role) {
+	r := copyRole(role)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.roles[gID] == nil {
+		c.roles[gID] = make(map[string]*discordgo.Role)
+	}
+	c.roles[gID][r.ID] = r
+}
+
+// DeleteRole removes a role from a guild.
+func (c *MemoryCache) DeleteRole(gID, rID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.roles[gID], rID)
+}
+
+// Member returns the member of a guild with the user ID.
+func (c *MemoryCache) Member(gID, uID string) (*discordgo.Member, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m, ok := c.members[gID][uID]
+	return m, ok
+}
+
+// Members returns the members of a guild, ordered by user ID.
+func (c *MemoryCache) Members(gID string) []*discordgo.Member {
+	c.mu.RLock()
+	members := make([]*discordgo.Member, 0, len(c.members[gID]))
+	for _, m := range c.members[gID] {
+		members = append(members, m)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(members, func(i, j int) bool { return idLess(members[i].User.ID, members[j].User.ID) })
+	return members
+}
+
+// SetMember adds or replaces a member of a guild.
+func (c *MemoryCache) SetMember(gID string, member *discordgo.Member) {
+	m := copyMember(member)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setMember(gID, m)
+}
+
+func (c *MemoryCache) setMember(gID string, member *discordgo.Member) {
+	if member.User == nil {
+		return
+	}
+	if c.members[gID] == nil {
+		c.members[gID] = make(map[string]*discordgo.Member)
+	}
+	c.members[gID][member.User.ID] = member
+}
+
+// DeleteMember removes a member from a guild.
+func (c *MemoryCache) DeleteMember(gID, uID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.members[gID], uID)
+}
+
+// idLess orders snowflake IDs numerically without parsing them.
+func idLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
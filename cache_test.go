@@ -0,0 +1,159 @@
+package godbot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMemoryCache(t *testing.T) {
+	text := func(id string, position int) *discordgo.Channel {
+		return &discordgo.Channel{ID: id, Type: discordgo.ChannelTypeGuildText, Position: position}
+	}
+	member := func(id string) *discordgo.Member {
+		return &discordgo.Member{User: &discordgo.User{ID: id}}
+	}
+	guild := func(id string) *discordgo.Guild {
+		return &discordgo.Guild{
+			ID:       id,
+			Channels: []*discordgo.Channel{text(id+"1", 2), text(id+"2", 0), text(id+"3", 1)},
+			Roles:    []*discordgo.Role{{ID: id}, {ID: id + "9"}},
+			Members:  []*discordgo.Member{member("u1"), member("u2")},
+		}
+	}
+	ids := func(channels []*discordgo.Channel) []string {
+		out := []string{}
+		for _, ch := range channels {
+			out = append(out, ch.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name  string
+		setup func(c *MemoryCache)
+		query func(c *MemoryCache) []string
+		want  []string
+	}{
+		{
+			name:  "guild channels ordered by position",
+			setup: func(c *MemoryCache) { c.SetGuild(guild("10")) },
+			query: func(c *MemoryCache) []string { return ids(c.GuildChannels("10")) },
+			want:  []string{"102", "103", "101"},
+		},
+		{
+			name: "equal positions ordered by ID",
+			setup: func(c *MemoryCache) {
+				c.SetChannel(&discordgo.Channel{ID: "100", GuildID: "1", Type: discordgo.ChannelTypeGuildText})
+				c.SetChannel(&discordgo.Channel{ID: "20", GuildID: "1", Type: discordgo.ChannelTypeGuildText})
+				c.SetChannel(&discordgo.Channel{ID: "3", GuildID: "1", Type: discordgo.ChannelTypeGuildText})
+			},
+			query: func(c *MemoryCache) []string { return ids(c.GuildChannels("1")) },
+			want:  []string{"3", "20", "100"},
+		},
+		{
+			name:  "guild payload channels get the guild ID",
+			setup: func(c *MemoryCache) { c.SetGuild(guild("10")) },
+			query: func(c *MemoryCache) []string {
+				ch, _ := c.Channel("101")
+				return []string{ch.GuildID}
+			},
+			want: []string{"10"},
+		},
+		{
+			name: "private channels are kept apart",
+			setup: func(c *MemoryCache) {
+				c.SetGuild(guild("10"))
+				c.SetChannel(&discordgo.Channel{ID: "5", Type: discordgo.ChannelTypeDM})
+			},
+			query: func(c *MemoryCache) []string {
+				return append(ids(c.PrivateChannels()), ids(c.Channels())...)
+			},
+			want: []string{"5", "101", "102", "103"},
+		},
+		{
+			name: "deleting a guild removes its channels, roles and members",
+			setup: func(c *MemoryCache) {
+				c.SetGuild(guild("10"))
+				c.SetGuild(guild("20"))
+				c.DeleteGuild("10")
+			},
+			query: func(c *MemoryCache) []string {
+				got := ids(c.Channels())
+				for _, r := range c.Roles("10") {
+					got = append(got, r.ID)
+				}
+				for _, m := range c.Members("10") {
+					got = append(got, m.User.ID)
+				}
+				for _, g := range c.Guilds() {
+					got = append(got, g.ID)
+				}
+				return got
+			},
+			want: []string{"201", "202", "203", "20"},
+		},
+		{
+			name: "deleting a channel unlinks it from its guild",
+			setup: func(c *MemoryCache) {
+				c.SetGuild(guild("10"))
+				c.DeleteChannel("102")
+				c.DeleteChannel("404")
+			},
+			query: func(c *MemoryCache) []string { return ids(c.GuildChannels("10")) },
+			want:  []string{"103", "101"},
+		},
+		{
+			name: "members without a user are ignored",
+			setup: func(c *MemoryCache) {
+				c.SetMember("10", member("u3"))
+				c.SetMember("10", &discordgo.Member{})
+			},
+			query: func(c *MemoryCache) []string {
+				got := []string{}
+				for _, m := range c.Members("10") {
+					got = append(got, m.User.ID)
+				}
+				return got
+			},
+			want: []string{"u3"},
+		},
+		{
+			name: "stored values are copies",
+			setup: func(c *MemoryCache) {
+				g := guild("10")
+				ch := text("50", 0)
+				ch.GuildID = "10"
+				c.SetGuild(g)
+				c.SetChannel(ch)
+				c.SetRole("10", g.Roles[1])
+
+				g.Name = "changed"
+				g.Channels[0].Name = "changed"
+				g.Roles[1].Name = "changed"
+				g.Members[0].Nick = "changed"
+				ch.Name = "changed"
+			},
+			query: func(c *MemoryCache) []string {
+				g, _ := c.Guild("10")
+				ch, _ := c.Channel("101")
+				other, _ := c.Channel("50")
+				r, _ := c.Role("10", "109")
+				m, _ := c.Member("10", "u1")
+				return []string{g.Name, ch.Name, other.Name, r.Name, m.Nick}
+			},
+			want: []string{"", "", "", "", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemoryCache()
+			tt.setup(c)
+			if got := tt.query(c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
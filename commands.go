@@ -0,0 +1,431 @@
+package godbot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Command errors.
+var (
+	ErrBadCommand    = errors.New("godbot: command needs a name and a handler")
+	ErrCommandExists = errors.New("godbot: command name or alias already registered")
+	ErrUnclosedQuote = errors.New("unclosed quote in arguments")
+	ErrMissingArgs   = errors.New("missing argument")
+)
+
+// Command is a text command dispatched by a Router.
+type Command struct {
+	Name        string               `json:"name"`
+	Aliases     []string             `json:"aliases,omitempty"`
+	Args        []Arg                `json:"args,omitempty"`
+	Help        string               `json:"help,omitempty"`
+	Category    string               `json:"-"`                // Groups commands in help, "General" if empty.
+	Permissions int64                `json:"-"`                // Permissions the invoker needs in the channel.
+	Hidden      bool                 `json:"hidden,omitempty"` // Left out of the help listing.
+	Cooldowns   []Cooldown           `json:"-"`                // Checked before the command's middleware.
+	Middleware  []Middleware         `json:"-"`                // Runs after the router's middleware.
+	Handler     func(*Context) error `json:"-"`
+}
+
+// Arg describes an argument a command takes.
+type Arg struct {
+	Name     string  `json:"name"`
+	Help     string  `json:"help,omitempty"`
+	Type     ArgType `json:"type"`
+	Optional bool    `json:"optional,omitempty"`
+	Rest     bool    `json:"rest,omitempty"` // Takes the remaining text, only valid as the last argument.
+}
+
+// Usage returns the usage line of the command, required arguments are shown
+// as <name> and optional ones as [name]. Typed arguments are followed by
+// their type, such as <count:number>.
+func (cmd *Command) Usage(prefix string) string {
+	usage := prefix + cmd.Name
+	for _, a := range cmd.Args {
+		name := a.Name
+		if a.Type != ArgString {
+			name += ":" + a.Type.String()
+		}
+		if a.Rest {
+			name += "..."
+		}
+		if a.Optional {
+			usage += " [" + name + "]"
+		} else {
+			usage += " <" + name + ">"
+		}
+	}
+	return usage
+}
+
+// parseArgs splits the arguments, a trailing Rest argument gets the remaining
+// text as it was typed.
+func (cmd *Command) parseArgs(raw string) ([]string, error) {
+	var max int
+	if n := len(cmd.Args); n > 0 && cmd.Args[n-1].Rest {
+		max = n
+	}
+	return splitArgs(raw, max)
+}
+
+// Context is passed to a command's handler.
+type Context struct {
+	Core    *Core
+	Session *discordgo.Session
+	Message *discordgo.Message
+	Guild   *discordgo.Guild // nil for private messages.
+	Channel *discordgo.Channel
+	Author  *discordgo.User
+	Command *Command
+	Prefix  string   // Prefix the command was invoked with.
+	Args    []string // Parsed arguments.
+	Raw     string   // Text following the command name.
+
+	values map[string]interface{} // [arg name] converted value
+}
+
+// Reply sends a message to the channel the command was invoked in.
+func (ctx *Context) Reply(content string) (*discordgo.Message, error) {
+	return ctx.Session.ChannelMessageSend(ctx.Message.ChannelID, content)
+}
+
+// Registry holds command metadata by name and alias. A Router dispatches the
+// commands of its registry, bots using their own MessageCreate handler can
+// fill one just to describe their commands for help and documentation.
+type Registry struct {
+	mu       sync.RWMutex
+	commands map[string]*Command // [name or alias] command
+	ordered  []*Command
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{commands: make(map[string]*Command)}
+}
+
+// Add adds a command, it does not need a handler. Names and aliases are
+// matched without case.
+func (reg *Registry) Add(cmd *Command) error {
+	if cmd == nil || cmd.Name == "" {
+		return ErrBadCommand
+	}
+
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, name := range names {
+		if _, ok := reg.commands[strings.ToLower(name)]; ok {
+			return ErrCommandExists
+		}
+	}
+
+	for _, name := range names {
+		reg.commands[strings.ToLower(name)] = cmd
+	}
+	reg.ordered = append(reg.ordered, cmd)
+	return nil
+}
+
+// Remove removes a command and its aliases by name.
+func (reg *Registry) Remove(name string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	cmd, ok := reg.commands[strings.ToLower(name)]
+	if !ok {
+		return
+	}
+	for key, c := range reg.commands {
+		if c == cmd {
+			delete(reg.commands, key)
+		}
+	}
+	for n, c := range reg.ordered {
+		if c == cmd {
+			reg.ordered = append(reg.ordered[:n], reg.ordered[n+1:]...)
+			break
+		}
+	}
+}
+
+// Command finds a command by name or alias.
+func (reg *Registry) Command(name string) *Command {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.commands[strings.ToLower(name)]
+}
+
+// Commands returns every command, sorted by name.
+func (reg *Registry) Commands() []*Command {
+	reg.mu.RLock()
+	cmds := make([]*Command, len(reg.ordered))
+	copy(cmds, reg.ordered)
+	reg.mu.RUnlock()
+
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	return cmds
+}
+
+// Router parses prefixed or mentioned messages and dispatches them to
+// commands. It co-exists with any other MessageCreate handlers.
+type Router struct {
+	Prefix        string        // Default prefix, used where a guild has none set.
+	MentionPrefix bool          // Also accept a mention of the bot as the prefix.
+	Cooldowns     CooldownStore // Uses of command cooldowns, in memory if nil.
+
+	registry *Registry
+
+	mu         sync.RWMutex
+	prefixes   map[string]string // [guild ID] prefix
+	middleware []Middleware
+}
+
+// NewRouter creates a router with a default prefix.
+func NewRouter(prefix string) *Router {
+	return &Router{
+		Prefix:   prefix,
+		registry: NewRegistry(),
+		prefixes: make(map[string]string),
+	}
+}
+
+// Register adds a command, it needs a handler.
+func (r *Router) Register(cmd *Command) error {
+	if cmd == nil || cmd.Handler == nil {
+		return ErrBadCommand
+	}
+	return r.registry.Add(cmd)
+}
+
+// Unregister removes a command and its aliases by name.
+func (r *Router) Unregister(name string) {
+	r.registry.Remove(name)
+}
+
+// Command finds a command by name or alias.
+func (r *Router) Command(name string) *Command {
+	return r.registry.Command(name)
+}
+
+// Commands returns every registered command, sorted by name.
+func (r *Router) Commands() []*Command {
+	return r.registry.Commands()
+}
+
+// Registry returns the registry holding the router's commands.
+func (r *Router) Registry() *Registry {
+	return r.registry
+}
+
+// SetPrefix assigns a prefix for a guild, an empty prefix restores the default.
+func (r *Router) SetPrefix(gID, prefix string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if prefix == "" {
+		delete(r.prefixes, gID)
+		return
+	}
+	r.prefixes[gID] = prefix
+}
+
+// GuildPrefix returns the prefix used in a guild.
+func (r *Router) GuildPrefix(gID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if p, ok := r.prefixes[gID]; ok {
+		return p
+	}
+	return r.Prefix
+}
+
+// needsContent reports if the router reads commands from message content,
+// which guild messages only carry with the MessageContent intent. Mentions of
+// the bot carry it regardless.
+func (r *Router) needsContent() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Prefix != "" || len(r.prefixes) > 0
+}
+
+// UseRouter attaches a command router to the bot, replacing the previous one.
+// A router with a prefix needs the privileged MessageContent intent in guilds,
+// Start fails with an IntentError unless it is requested.
+// Messages are still passed to every other MessageCreate handler.
+func (bot *Core) UseRouter(r *Router) {
+	var sub *Subscription
+	if r != nil {
+		sub, _ = bot.Subscribe(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+			r.dispatch(bot, s, m)
+		}, 0)
+	}
+
+	bot.muRouter.Lock()
+	old := bot.routerSub
+	bot.router = r
+	bot.routerSub = sub
+	bot.muRouter.Unlock()
+
+	old.Unsubscribe()
+}
+
+// Router returns the command router attached to the bot.
+func (bot *Core) Router() *Router {
+	bot.muRouter.Lock()
+	defer bot.muRouter.Unlock()
+	return bot.router
+}
+
+// dispatch parses a message and runs the command it invokes.
+func (r *Router) dispatch(bot *Core, s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.Author == nil || (bot.User != nil && m.Author.ID == bot.User.ID) {
+		return
+	}
+
+	prefix, text, ok := r.trimPrefix(bot, m.GuildID, m.Content)
+	if !ok {
+		return
+	}
+
+	name, raw := splitFirst(text)
+	cmd := r.Command(name)
+	if cmd == nil {
+		return
+	}
+
+	ctx := &Context{
+		Core:    bot,
+		Session: s,
+		Message: m.Message,
+		Author:  m.Author,
+		Command: cmd,
+		Prefix:  prefix,
+		Raw:     raw,
+	}
+	if m.GuildID != "" {
+		if g := bot.GetGuild(m.GuildID); g != nil {
+			ctx.Guild = g.Guild
+		}
+	}
+	if c := bot.GetChannel(m.ChannelID); c != nil {
+		ctx.Channel = c.Channel
+	} else if c, err := s.Channel(m.ChannelID); err == nil {
+		ctx.Channel = c
+	}
+
+	if !ctx.CanRun(cmd) {
+		if ctx.Guild == nil {
+			ctx.Reply("This command can only be used in a server.")
+		} else {
+			ctx.Reply(fmt.Sprintf("You need %s to use this command.", PermissionString(cmd.Permissions)))
+		}
+		return
+	}
+
+	var err error
+	ctx.Args, err = cmd.parseArgs(raw)
+	if err == nil {
+		err = cmd.convertArgs(ctx)
+	}
+	if err != nil {
+		ctx.Reply(fmt.Sprintf("%s\nUsage: `%s`", err, cmd.Usage(prefix)))
+		return
+	}
+
+	r.mu.RLock()
+	mws := r.middleware
+	r.mu.RUnlock()
+
+	h := chain(func(d *Dispatch) error {
+		return d.Context.Command.Handler(d.Context)
+	}, mws, []Middleware{r.cooldowns()}, cmd.Middleware)
+	if err := h(commandDispatch(ctx)); err != nil {
+		bot.errorlog(fmt.Errorf("godbot: command %s: %v", cmd.Name, err))
+	}
+}
+
+// trimPrefix removes the guild prefix or a mention of the bot from content.
+func (r *Router) trimPrefix(bot *Core, gID, content string) (prefix, text string, ok bool) {
+	if r.MentionPrefix && bot.User != nil {
+		for _, mention := range []string{"<@" + bot.User.ID + ">", "<@!" + bot.User.ID + ">"} {
+			if strings.HasPrefix(content, mention) {
+				return mention + " ", strings.TrimSpace(content[len(mention):]), true
+			}
+		}
+	}
+
+	prefix = r.GuildPrefix(gID)
+	if prefix == "" || !strings.HasPrefix(content, prefix) {
+		return "", "", false
+	}
+	return prefix, content[len(prefix):], true
+}
+
+// splitFirst splits off the first word of text.
+func splitFirst(text string) (first, rest string) {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	n := strings.IndexFunc(text, unicode.IsSpace)
+	if n < 0 {
+		return text, ""
+	}
+	return text[:n], strings.TrimSpace(text[n:])
+}
+
+// splitArgs splits text on whitespace. Double quotes group words into one
+// argument and a backslash escapes the next character. With max above zero,
+// the text from the max-th argument on is the last argument, untouched.
+func splitArgs(text string, max int) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	var quote rune
+	var inArg, escaped bool
+
+	for i, c := range text {
+		if !inArg && !unicode.IsSpace(c) && max > 0 && len(args) == max-1 {
+			return append(args, strings.TrimRightFunc(text[i:], unicode.IsSpace)), nil
+		}
+
+		switch {
+		case escaped:
+			cur.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '"':
+			quote = c
+			inArg = true
+		case unicode.IsSpace(c):
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, ErrUnclosedQuote
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
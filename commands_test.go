@@ -0,0 +1,38 @@
+package godbot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want []string
+		err  error
+	}{
+		{text: "", want: nil},
+		{text: "one two  three", want: []string{"one", "two", "three"}},
+		{text: "I don't know", want: []string{"I", "don't", "know"}},
+		{text: `say "hello world" now`, want: []string{"say", "hello world", "now"}},
+		{text: `a""b`, want: []string{"ab"}},
+		{text: `""`, want: []string{""}},
+		{text: `escaped\ space \"quote\"`, want: []string{"escaped space", `"quote"`}},
+		{text: `"unclosed`, err: ErrUnclosedQuote},
+		{text: "#general  hello   \"world\"  ", max: 2, want: []string{"#general", "hello   \"world\""}},
+		{text: `he said "hi`, max: 1, want: []string{`he said "hi`}},
+		{text: "only", max: 2, want: []string{"only"}},
+	}
+
+	for _, tt := range tests {
+		got, err := splitArgs(tt.text, tt.max)
+		if err != tt.err {
+			t.Errorf("splitArgs(%q, %d) error = %v, want %v", tt.text, tt.max, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q, %d) = %q, want %q", tt.text, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package godbot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Component errors.
+var (
+	ErrBadComponent    = errors.New("godbot: component needs a custom ID and a handler")
+	ErrComponentExists = errors.New("godbot: component custom ID already handled")
+)
+
+// Component handles clicks on buttons, choices in select menus and submitted
+// modals. Custom IDs are matched up to the first ":", anything after it is
+// passed to the handler as arguments, so "vote:yes" and "vote:no" are both
+// handled by a component with the custom ID "vote". A component bound to a
+// message only handles interactions on that message and is preferred over
+// one that is not.
+type Component struct {
+	CustomID    string
+	MessageID   string        // Only handle interactions on this message.
+	Permissions int64         // Permissions the user needs in the channel.
+	Timeout     time.Duration // Removed after this long, zero never expires.
+	OnTimeout   func()        // Called when the component expires.
+	Handler     func(*ComponentContext) error
+
+	bot   *Core
+	key   string
+	timer *time.Timer
+}
+
+// components holds the handled components by message and custom ID.
+type components struct {
+	sync.Mutex
+	handlers map[string]*Component // [message ID/custom ID] component
+	sub      *Subscription
+}
+
+func componentKey(mID, customID string) string {
+	return mID + "/" + customID
+}
+
+// AddComponent starts handling interactions for a component.
+func (bot *Core) AddComponent(c *Component) error {
+	if c == nil || c.CustomID == "" || strings.Contains(c.CustomID, ":") || c.Handler == nil {
+		return ErrBadComponent
+	}
+
+	cs := &bot.components
+	cs.Lock()
+	defer cs.Unlock()
+
+	key := componentKey(c.MessageID, c.CustomID)
+	if _, ok := cs.handlers[key]; ok {
+		return ErrComponentExists
+	}
+	if cs.handlers == nil {
+		cs.handlers = make(map[string]*Component)
+	}
+	if cs.sub == nil {
+		cs.sub, _ = bot.Subscribe(bot.componentDispatch, 0)
+	}
+
+	c.bot, c.key = bot, key
+	cs.handlers[key] = c
+	if c.Timeout > 0 {
+		c.timer = time.AfterFunc(c.Timeout, c.expire)
+	}
+	return nil
+}
+
+// Remove stops handling the component. It is safe to call more than once.
+func (c *Component) Remove() {
+	if c == nil || c.bot == nil {
+		return
+	}
+	c.remove()
+}
+
+// remove deletes the component, reporting if it was still handled.
+func (c *Component) remove() bool {
+	cs := &c.bot.components
+	cs.Lock()
+	defer cs.Unlock()
+
+	if cs.handlers[c.key] != c {
+		return false
+	}
+	delete(cs.handlers, c.key)
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	return true
+}
+
+func (c *Component) expire() {
+	if c.remove() && c.OnTimeout != nil {
+		c.OnTimeout()
+	}
+}
+
+// RemoveComponents stops handling every component bound to a message.
+func (bot *Core) RemoveComponents(mID string) {
+	cs := &bot.components
+	cs.Lock()
+	var bound []*Component
+	for _, c := range cs.handlers {
+		if c.MessageID == mID {
+			bound = append(bound, c)
+		}
+	}
+	cs.Unlock()
+
+	for _, c := range bound {
+		c.Remove()
+	}
+}
+
+// component finds the handler for a custom ID, preferring one bound to the message.
+func (bot *Core) component(mID, customID string) *Component {
+	cs := &bot.components
+	cs.Lock()
+	defer cs.Unlock()
+
+	if c, ok := cs.handlers[componentKey(mID, customID)]; ok && mID != "" {
+		return c
+	}
+	return cs.handlers[componentKey("", customID)]
+}
+
+// componentDispatch routes component and modal interactions to their handler.
+func (bot *Core) componentDispatch(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	ctx := &ComponentContext{
+		InteractionContext: InteractionContext{Core: bot, Session: s, Interaction: i.Interaction},
+	}
+
+	switch i.Type {
+	case discordgo.InteractionMessageComponent:
+		data := i.MessageComponentData()
+		ctx.CustomID, ctx.Values = data.CustomID, data.Values
+	case discordgo.InteractionModalSubmit:
+		data := i.ModalSubmitData()
+		ctx.CustomID = data.CustomID
+		ctx.Fields = modalFields(data.Components)
+	default:
+		return
+	}
+
+	var mID string
+	if i.Message != nil {
+		mID = i.Message.ID
+	}
+
+	parts := strings.Split(ctx.CustomID, ":")
+	c := bot.component(mID, parts[0])
+	if c == nil {
+		return
+	}
+	ctx.Component, ctx.Args = c, parts[1:]
+
+	if c.Permissions != 0 {
+		if i.Member == nil || !hasPermissions(i.Member.Permissions, c.Permissions) {
+			err := ctx.RespondEphemeral(fmt.Sprintf("You need %s to use this.", PermissionString(c.Permissions)))
+			if err != nil {
+				bot.errorlog(err)
+			}
+			return
+		}
+	}
+
+	if err := c.Handler(ctx); err != nil {
+		bot.errorlog(fmt.Errorf("godbot: component %s: %v", ctx.CustomID, err))
+		ctx.fail()
+	}
+}
+
+// ComponentContext is passed to a component's handler.
+type ComponentContext struct {
+	InteractionContext
+	Component *Component
+	CustomID  string            // Full custom ID of the component.
+	Args      []string          // Parts of the custom ID after the first ":".
+	Values    []string          // Choices of a select menu.
+	Fields    map[string]string // [custom ID] value of a submitted modal's text inputs.
+}
+
+// Update edits the message the component is attached to as the response.
+func (ctx *ComponentContext) Update(data *discordgo.InteractionResponseData) error {
+	return ctx.respond(discordgo.InteractionResponseUpdateMessage, data)
+}
+
+// DeferUpdate acknowledges the interaction without changing the message yet.
+func (ctx *ComponentContext) DeferUpdate() error {
+	return ctx.respond(discordgo.InteractionResponseDeferredMessageUpdate, nil)
+}
+
+// ShowModal answers the interaction with a modal of text inputs. Its submission
+// is handled by the component with the modal's custom ID.
+func (ctx *InteractionContext) ShowModal(customID, title string, inputs ...discordgo.TextInput) error {
+	rows := make([]discordgo.MessageComponent, len(inputs))
+	for n, in := range inputs {
+		rows[n] = discordgo.ActionsRow{Components: []discordgo.MessageComponent{in}}
+	}
+	return ctx.respond(discordgo.InteractionResponseModal, &discordgo.InteractionResponseData{
+		CustomID:   customID,
+		Title:      title,
+		Components: rows,
+	})
+}
+
+// modalFields collects the values of a modal's text inputs.
+func modalFields(rows []discordgo.MessageComponent) map[string]string {
+	fields := make(map[string]string)
+	for _, row := range rows {
+		r, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, c := range r.Components {
+			if in, ok := c.(*discordgo.TextInput); ok {
+				fields[in.CustomID] = in.Value
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,244 @@
+package godbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// CooldownScope selects who shares a cooldown bucket.
+type CooldownScope int
+
+// Cooldown scopes.
+const (
+	CooldownUser    CooldownScope = iota // Each user has their own bucket.
+	CooldownChannel                      // Everyone in a channel shares a bucket.
+	CooldownGuild                        // Everyone in a guild shares a bucket.
+	CooldownRole                         // Members with RoleID share a bucket.
+)
+
+func (sc CooldownScope) String() string {
+	switch sc {
+	case CooldownChannel:
+		return "channel"
+	case CooldownGuild:
+		return "guild"
+	case CooldownRole:
+		return "role"
+	}
+	return "user"
+}
+
+// Cooldown limits a command to Uses per duration in a bucket.
+type Cooldown struct {
+	Uses        int
+	Per         time.Duration
+	Scope       CooldownScope
+	RoleID      string   // Role sharing the bucket for CooldownRole, others are not limited by it.
+	BypassRoles []string // Members with any of these roles are not limited.
+}
+
+// CooldownBucket is a bucket of uses checked by a CooldownStore.
+type CooldownBucket struct {
+	Key  string
+	Uses int           // Uses allowed per duration.
+	Per  time.Duration // Uses older than this may be forgotten.
+}
+
+// CooldownStore keeps the uses of cooldown buckets. Implementations backed by
+// a database keep cooldowns across restarts.
+type CooldownStore interface {
+	// Take records a use in every bucket when all of them have room, otherwise
+	// it records nothing and returns how long until they do. Commands run
+	// concurrently, so checking and recording must be one atomic step.
+	Take(buckets []CooldownBucket, now time.Time) (time.Duration, error)
+}
+
+// MemoryCooldowns is the default CooldownStore. It can be saved and loaded as
+// JSON to keep cooldowns across a restart.
+type MemoryCooldowns struct {
+	mu      sync.Mutex
+	buckets map[string][]time.Time // [bucket key] times of uses, oldest first
+}
+
+// NewMemoryCooldowns creates an empty in-memory store.
+func NewMemoryCooldowns() *MemoryCooldowns {
+	return &MemoryCooldowns{buckets: make(map[string][]time.Time)}
+}
+
+// Take records a use in every bucket when all of them have room.
+func (mc *MemoryCooldowns) Take(buckets []CooldownBucket, now time.Time) (time.Duration, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	var wait time.Duration
+	for _, b := range buckets {
+		times := mc.trim(b.Key, b.Per, now)
+		if len(times) < b.Uses {
+			continue
+		}
+		// Room opens when the use that fills the bucket ages out.
+		if w := times[len(times)-b.Uses].Add(b.Per).Sub(now); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+
+	if mc.buckets == nil {
+		mc.buckets = make(map[string][]time.Time)
+	}
+	for _, b := range buckets {
+		mc.buckets[b.Key] = append(mc.buckets[b.Key], now)
+	}
+	return 0, nil
+}
+
+// trim forgets uses older than per, the lock must be held.
+func (mc *MemoryCooldowns) trim(key string, per time.Duration, now time.Time) []time.Time {
+	times := mc.buckets[key]
+	n := 0
+	for n < len(times) && !times[n].Add(per).After(now) {
+		n++
+	}
+	if n == len(times) {
+		delete(mc.buckets, key)
+		return nil
+	}
+	times = times[n:]
+	mc.buckets[key] = times
+	return times
+}
+
+// MarshalJSON saves every bucket.
+func (mc *MemoryCooldowns) MarshalJSON() ([]byte, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return json.Marshal(mc.buckets)
+}
+
+// UnmarshalJSON loads buckets saved by MarshalJSON, replacing the current ones.
+func (mc *MemoryCooldowns) UnmarshalJSON(data []byte) error {
+	buckets := make(map[string][]time.Time)
+	if err := json.Unmarshal(data, &buckets); err != nil {
+		return err
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.buckets = buckets
+	return nil
+}
+
+// cooldowns checks the command's cooldowns before it runs, replying how long
+// to wait when a bucket is full.
+func (r *Router) cooldowns() Middleware {
+	return func(next DispatchFunc) DispatchFunc {
+		return func(d *Dispatch) error {
+			ctx := d.Context
+			cmd := ctx.Command
+			if len(cmd.Cooldowns) == 0 {
+				return next(d)
+			}
+
+			roles := ctx.memberRoles()
+			var buckets []CooldownBucket
+			for n, cd := range cmd.Cooldowns {
+				if key, ok := cd.bucket(ctx, n, roles); ok {
+					buckets = append(buckets, CooldownBucket{Key: key, Uses: cd.Uses, Per: cd.Per})
+				}
+			}
+			if len(buckets) == 0 {
+				return next(d)
+			}
+
+			wait, err := r.cooldownStore().Take(buckets, time.Now())
+			if err != nil {
+				return err
+			} else if wait > 0 {
+				_, err = ctx.Reply(fmt.Sprintf("Slow down, try again in %s.", waitString(wait)))
+				return err
+			}
+			return next(d)
+		}
+	}
+}
+
+// bucket returns the key of the bucket the invocation falls in, false when
+// the cooldown does not apply.
+func (cd *Cooldown) bucket(ctx *Context, n int, roles []string) (string, bool) {
+	if cd.Uses <= 0 || cd.Per <= 0 {
+		return "", false
+	}
+	for _, rID := range cd.BypassRoles {
+		if containsString(roles, rID) {
+			return "", false
+		}
+	}
+
+	var id string
+	switch cd.Scope {
+	case CooldownUser:
+		id = ctx.Author.ID
+	case CooldownChannel:
+		id = ctx.Message.ChannelID
+	case CooldownGuild:
+		id = ctx.Message.GuildID
+		if id == "" {
+			// Private messages are limited per user.
+			id = ctx.Author.ID
+		}
+	case CooldownRole:
+		if !containsString(roles, cd.RoleID) {
+			return "", false
+		}
+		id = cd.RoleID
+	}
+	return fmt.Sprintf("%s/%d/%s/%s", ctx.Command.Name, n, cd.Scope, id), true
+}
+
+// cooldownStore returns the router's store, creating the default.
+func (r *Router) cooldownStore() CooldownStore {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Cooldowns == nil {
+		r.Cooldowns = NewMemoryCooldowns()
+	}
+	return r.Cooldowns
+}
+
+// memberRoles returns the roles of the invoker, nil in private messages.
+func (ctx *Context) memberRoles() []string {
+	if ctx.Message.GuildID == "" {
+		return nil
+	}
+	if ctx.Message.Member != nil && ctx.Message.Member.Roles != nil {
+		return ctx.Message.Member.Roles
+	}
+	m, err := ctx.Core.GetMember(ctx.Message.GuildID, ctx.Author.ID)
+	if err != nil {
+		return nil
+	}
+	return m.Roles
+}
+
+// waitString rounds a wait up to whole seconds, or minutes when long.
+func waitString(d time.Duration) string {
+	secs := int(math.Ceil(d.Seconds()))
+	if secs < 120 {
+		return fmt.Sprintf("%ds", secs)
+	}
+	return fmt.Sprintf("%dm", (secs+59)/60)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
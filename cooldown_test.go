@@ -0,0 +1,112 @@
+package godbot
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCooldownTake(t *testing.T) {
+	start := time.Unix(1000, 0)
+	user := CooldownBucket{Key: "user", Uses: 2, Per: 10 * time.Second}
+	guild := CooldownBucket{Key: "guild", Uses: 3, Per: time.Minute}
+
+	type take struct {
+		at      time.Duration // After start.
+		buckets []CooldownBucket
+		wait    time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{
+			name: "uses until the bucket is full",
+			takes: []take{
+				{0, []CooldownBucket{user}, 0},
+				{time.Second, []CooldownBucket{user}, 0},
+				{2 * time.Second, []CooldownBucket{user}, 8 * time.Second},
+			},
+		},
+		{
+			name: "room opens when the oldest use ages out",
+			takes: []take{
+				{0, []CooldownBucket{user}, 0},
+				{4 * time.Second, []CooldownBucket{user}, 0},
+				{10 * time.Second, []CooldownBucket{user}, 0},
+				{11 * time.Second, []CooldownBucket{user}, 3 * time.Second},
+				{14 * time.Second, []CooldownBucket{user}, 0},
+			},
+		},
+		{
+			name: "a full bucket records nothing in the others",
+			takes: []take{
+				{0, []CooldownBucket{user}, 0},
+				{0, []CooldownBucket{user}, 0},
+				{0, []CooldownBucket{user, guild}, 10 * time.Second},
+				{0, []CooldownBucket{user, guild}, 10 * time.Second},
+				{0, []CooldownBucket{guild}, 0},
+				{0, []CooldownBucket{guild}, 0},
+				{0, []CooldownBucket{guild}, 0},
+				{0, []CooldownBucket{guild}, time.Minute},
+			},
+		},
+		{
+			name: "the longest wait of the full buckets",
+			takes: []take{
+				{0, []CooldownBucket{user, guild}, 0},
+				{0, []CooldownBucket{guild}, 0},
+				{5 * time.Second, []CooldownBucket{user, guild}, 0},
+				{6 * time.Second, []CooldownBucket{user, guild}, time.Minute - 6*time.Second},
+			},
+		},
+		{
+			name: "no buckets is never limited",
+			takes: []take{
+				{0, nil, 0},
+				{0, nil, 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := NewMemoryCooldowns()
+			for n, tk := range tt.takes {
+				wait, err := mc.Take(tk.buckets, start.Add(tk.at))
+				if err != nil {
+					t.Fatalf("take %d: %v", n, err)
+				} else if wait != tk.wait {
+					t.Errorf("take %d: got wait %v, want %v", n, wait, tk.wait)
+				}
+			}
+		})
+	}
+}
+
+func TestCooldownTakeConcurrent(t *testing.T) {
+	mc := NewMemoryCooldowns()
+	buckets := []CooldownBucket{{Key: "k", Uses: 10, Per: time.Minute}}
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if wait, _ := mc.Take(buckets, now); wait == 0 {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if taken != 10 {
+		t.Errorf("got %d uses, want 10", taken)
+	}
+}
@@ -0,0 +1,239 @@
+package godbot
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ErrBadHandler is returned when subscribing something that is not an event handler.
+var ErrBadHandler = errors.New("godbot: handler must be func(*discordgo.Session, *Event) with an optional error result")
+
+var (
+	sessionType   = reflect.TypeOf((*discordgo.Session)(nil))
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+	interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// Subscription is a handler registered on the bot's event bus.
+type Subscription struct {
+	bus      *eventBus
+	id       uint64
+	event    reflect.Type
+	priority int
+	call     func(*discordgo.Session, interface{}) error
+}
+
+// Unsubscribe removes the handler from the bus. It is safe to call more than once.
+func (sub *Subscription) Unsubscribe() {
+	if sub == nil {
+		return
+	}
+	sub.bus.remove(sub)
+}
+
+// eventBus holds every subscribed handler by event type, the zero value is ready to use.
+type eventBus struct {
+	mu       sync.RWMutex
+	nextID   uint64
+	handlers map[reflect.Type][]*Subscription
+	slots    map[string]*Subscription // Handlers assigned by the *Handler setters.
+}
+
+// Subscribe adds a handler for the event type in its second argument, any
+// number of handlers may subscribe to the same event. The handler has the form
+// func(*discordgo.Session, *discordgo.MessageCreate), optionally returning an
+// error that is logged. Using interface{} as the event type receives every
+// event. Handlers with a higher priority run first, equal priorities run in
+// the order they subscribed. A panicking handler is recovered and logged
+// without affecting the others. The *Handler setters subscribe at priority 0
+// and only replace the handler they assigned before.
+func (bot *Core) Subscribe(handler interface{}, priority int) (*Subscription, error) {
+	event, call, err := eventHandler(handler)
+	if err != nil {
+		return nil, err
+	}
+	return bot.bus.add(event, priority, call), nil
+}
+
+// AddHandler subscribes a handler for any event discordgo emits, including
+// events without a *Handler setter such as invites or threads. It is Subscribe
+// with the default priority. Like every handler it is not called in LiteMode.
+func (bot *Core) AddHandler(handler interface{}) (*Subscription, error) {
+	return bot.Subscribe(handler, 0)
+}
+
+// AddHandlerOnce subscribes a handler that is removed after its first call.
+func (bot *Core) AddHandlerOnce(handler interface{}) (*Subscription, error) {
+	event, call, err := eventHandler(handler)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	var sub *Subscription
+	added := make(chan struct{})
+	sub = bot.bus.add(event, 0, func(s *discordgo.Session, e interface{}) (err error) {
+		once.Do(func() {
+			<-added
+			sub.Unsubscribe()
+			err = call(s, e)
+		})
+		return
+	})
+	close(added)
+	return sub, nil
+}
+
+// setHandler replaces the handler assigned to a single slot, used by the
+// *Handler setters. A nil handler clears the slot.
+func (bot *Core) setHandler(slot string, handler interface{}) {
+	var sub *Subscription
+	if !reflect.ValueOf(handler).IsNil() {
+		var err error
+		sub, err = bot.Subscribe(handler, 0)
+		if err != nil {
+			// The setters are typed, this is a programming error.
+			panic(err)
+		}
+	}
+
+	b := &bot.bus
+	b.mu.Lock()
+	old := b.slots[slot]
+	if b.slots == nil {
+		b.slots = make(map[string]*Subscription)
+	}
+	if sub != nil {
+		b.slots[slot] = sub
+	} else {
+		delete(b.slots, slot)
+	}
+	b.mu.Unlock()
+
+	old.Unsubscribe()
+}
+
+// hasHandler checks if a slot has a handler assigned.
+func (bot *Core) hasHandler(slot string) bool {
+	bot.bus.mu.RLock()
+	defer bot.bus.mu.RUnlock()
+	return bot.bus.slots[slot] != nil
+}
+
+// publish calls every handler subscribed to the event.
+func (bot *Core) publish(s *discordgo.Session, event interface{}) {
+	for _, sub := range bot.bus.subscribers(reflect.TypeOf(event)) {
+		bot.invoke(sub, s, event)
+	}
+}
+
+// invoke calls a single handler, recovering and logging panics and errors.
+func (bot *Core) invoke(sub *Subscription, s *discordgo.Session, event interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			bot.errorlog(fmt.Errorf("godbot: %T handler panicked: %v", event, r))
+		}
+	}()
+
+	if err := sub.call(s, event); err != nil {
+		bot.errorlog(fmt.Errorf("godbot: %T handler: %v", event, err))
+	}
+}
+
+func (b *eventBus) add(event reflect.Type, priority int, call func(*discordgo.Session, interface{}) error) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.handlers == nil {
+		b.handlers = make(map[reflect.Type][]*Subscription)
+	}
+
+	b.nextID++
+	sub := &Subscription{bus: b, id: b.nextID, event: event, priority: priority, call: call}
+
+	// Copy on write, publishing works on the slice it read.
+	subs := make([]*Subscription, 0, len(b.handlers[event])+1)
+	subs = append(subs, b.handlers[event]...)
+	subs = append(subs, sub)
+	sort.SliceStable(subs, func(i, j int) bool { return subs[i].priority > subs[j].priority })
+	b.handlers[event] = subs
+	return sub
+}
+
+func (b *eventBus) remove(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs := b.handlers[sub.event]
+	for n, t := range subs {
+		if t == sub {
+			rest := make([]*Subscription, 0, len(subs)-1)
+			rest = append(rest, subs[:n]...)
+			rest = append(rest, subs[n+1:]...)
+			b.handlers[sub.event] = rest
+			return
+		}
+	}
+}
+
+// subscribers returns the handlers for an event type merged with the
+// interface{} handlers, ordered by priority.
+func (b *eventBus) subscribers(event reflect.Type) []*Subscription {
+	b.mu.RLock()
+	typed := b.handlers[event]
+	all := b.handlers[interfaceType]
+	b.mu.RUnlock()
+
+	if len(all) == 0 {
+		return typed
+	} else if len(typed) == 0 {
+		return all
+	}
+
+	subs := make([]*Subscription, 0, len(typed)+len(all))
+	subs = append(subs, typed...)
+	subs = append(subs, all...)
+	sort.SliceStable(subs, func(i, j int) bool {
+		if subs[i].priority != subs[j].priority {
+			return subs[i].priority > subs[j].priority
+		}
+		return subs[i].id < subs[j].id
+	})
+	return subs
+}
+
+// eventHandler validates a handler and wraps it in a uniform call.
+func eventHandler(handler interface{}) (reflect.Type, func(*discordgo.Session, interface{}) error, error) {
+	if handler == nil {
+		return nil, nil, ErrBadHandler
+	}
+
+	v := reflect.ValueOf(handler)
+	t := v.Type()
+	if t.Kind() != reflect.Func || v.IsNil() {
+		return nil, nil, ErrBadHandler
+	} else if t.NumIn() != 2 || t.In(0) != sessionType {
+		return nil, nil, ErrBadHandler
+	} else if t.NumOut() > 1 || (t.NumOut() == 1 && t.Out(0) != errorType) {
+		return nil, nil, ErrBadHandler
+	}
+
+	event := t.In(1)
+	if event != interfaceType && (event.Kind() != reflect.Ptr || event.Elem().Kind() != reflect.Struct) {
+		return nil, nil, ErrBadHandler
+	}
+
+	call := func(s *discordgo.Session, e interface{}) error {
+		out := v.Call([]reflect.Value{reflect.ValueOf(s), reflect.ValueOf(e)})
+		if len(out) == 1 && !out[0].IsNil() {
+			return out[0].Interface().(error)
+		}
+		return nil
+	}
+	return event, call, nil
+}
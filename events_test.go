@@ -0,0 +1,146 @@
+package godbot
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestEventBus(t *testing.T) {
+	type sub struct {
+		name     string
+		priority int
+		any      bool // Subscribes to interface{} instead of *discordgo.MessageCreate.
+		once     bool // Subscribes with AddHandlerOnce.
+		panics   bool
+	}
+
+	tests := []struct {
+		name        string
+		subs        []sub
+		unsubscribe []string // Names unsubscribed before publishing.
+		publish     int      // Times the event is published.
+		want        []string
+	}{
+		{
+			name:    "higher priority runs first",
+			subs:    []sub{{name: "low", priority: -1}, {name: "high", priority: 10}, {name: "default"}},
+			publish: 1,
+			want:    []string{"high", "default", "low"},
+		},
+		{
+			name:    "equal priorities run in subscribe order",
+			subs:    []sub{{name: "a"}, {name: "b"}, {name: "c"}},
+			publish: 1,
+			want:    []string{"a", "b", "c"},
+		},
+		{
+			name:    "interface{} handlers merge by priority",
+			subs:    []sub{{name: "any", any: true}, {name: "typed"}, {name: "any high", any: true, priority: 1}},
+			publish: 1,
+			want:    []string{"any high", "any", "typed"},
+		},
+		{
+			name:        "unsubscribed handlers are not called",
+			subs:        []sub{{name: "a"}, {name: "b"}, {name: "c", any: true}},
+			unsubscribe: []string{"b", "c"},
+			publish:     2,
+			want:        []string{"a", "a"},
+		},
+		{
+			name:        "unsubscribing twice is harmless",
+			subs:        []sub{{name: "a"}, {name: "b"}},
+			unsubscribe: []string{"a", "a"},
+			publish:     1,
+			want:        []string{"b"},
+		},
+		{
+			name:    "once handlers run a single time",
+			subs:    []sub{{name: "once", once: true}, {name: "always"}},
+			publish: 3,
+			want:    []string{"once", "always", "always", "always"},
+		},
+		{
+			name:    "a panicking handler does not stop the others",
+			subs:    []sub{{name: "panics", priority: 1, panics: true}, {name: "after"}},
+			publish: 1,
+			want:    []string{"panics", "after"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &Core{errlog: log.New(io.Discard, "", 0)}
+			var got []string
+			subs := make(map[string]*Subscription)
+
+			for _, s := range tt.subs {
+				s := s
+				called := func() {
+					got = append(got, s.name)
+					if s.panics {
+						panic(s.name)
+					}
+				}
+
+				var handler interface{} = func(*discordgo.Session, *discordgo.MessageCreate) { called() }
+				if s.any {
+					handler = func(*discordgo.Session, interface{}) { called() }
+				}
+
+				var sub *Subscription
+				var err error
+				if s.once {
+					sub, err = bot.AddHandlerOnce(handler)
+				} else {
+					sub, err = bot.Subscribe(handler, s.priority)
+				}
+				if err != nil {
+					t.Fatalf("subscribing %s: %v", s.name, err)
+				}
+				subs[s.name] = sub
+			}
+
+			for _, name := range tt.unsubscribe {
+				subs[name].Unsubscribe()
+			}
+			for i := 0; i < tt.publish; i++ {
+				bot.publish(nil, &discordgo.MessageCreate{})
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler interface{}
+		ok      bool
+	}{
+		{"typed event", func(*discordgo.Session, *discordgo.Ready) {}, true},
+		{"error result", func(*discordgo.Session, *discordgo.Ready) error { return nil }, true},
+		{"every event", func(*discordgo.Session, interface{}) {}, true},
+		{"nil", nil, false},
+		{"nil func", (func(*discordgo.Session, *discordgo.Ready))(nil), false},
+		{"not a func", "handler", false},
+		{"missing session", func(*discordgo.Ready) {}, false},
+		{"event by value", func(*discordgo.Session, discordgo.Ready) {}, false},
+		{"other result", func(*discordgo.Session, *discordgo.Ready) bool { return false }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := eventHandler(tt.handler)
+			if ok := err == nil; ok != tt.ok {
+				t.Errorf("got error %v, want ok %t", err, tt.ok)
+			}
+		})
+	}
+}
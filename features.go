@@ -0,0 +1,161 @@
+package godbot
+
+import "github.com/bwmarrin/discordgo"
+
+// Features selects which parts of the bot are active: the events delivered to
+// handlers, the caches kept and the gateway intents requested.
+type Features int
+
+// Features that can be enabled on the bot.
+const (
+	// FeatureMessages delivers message, reaction and typing events.
+	FeatureMessages Features = 1 << iota
+	// FeatureMembers delivers member events and keeps the member cache.
+	FeatureMembers
+	// FeatureChannels delivers channel events and keeps the channel cache.
+	FeatureChannels
+	// FeatureRoles delivers role events and keeps the role cache.
+	FeatureRoles
+	// FeatureGuildCache delivers guild events and keeps the guild cache.
+	FeatureGuildCache
+	// FeaturePrivate delivers direct messages and keeps the private channel cache.
+	FeaturePrivate
+
+	// FeaturesNone only connects, it is what LiteMode selects.
+	FeaturesNone Features = 0
+	// FeaturesAll enables everything, it is the default for New.
+	FeaturesAll = FeatureMessages | FeatureMembers | FeatureChannels |
+		FeatureRoles | FeatureGuildCache | FeaturePrivate
+)
+
+// Has checks if every feature in f2 is enabled.
+func (f Features) Has(f2 Features) bool {
+	return f&f2 == f2
+}
+
+// features returns the features in effect. Members, channels and roles are
+// kept per guild, so they need the guild cache.
+func (bot *Core) features() Features {
+	if bot.LiteMode {
+		return FeaturesNone
+	}
+
+	f := bot.Features
+	if f&(FeatureMembers|FeatureChannels|FeatureRoles) != 0 {
+		f |= FeatureGuildCache
+	}
+	return f
+}
+
+// connectionFlags returns which connections are queried from discord.
+func (bot *Core) connectionFlags() int {
+	var toUpdate int
+	f := bot.features()
+	if f.Has(FeatureGuildCache) {
+		toUpdate |= bwGuild
+	}
+	if f.Has(FeatureChannels) {
+		toUpdate |= bwChannel
+	}
+	if f.Has(FeaturePrivate) {
+		toUpdate |= bwPrivate
+	}
+	return toUpdate
+}
+
+// featureIntents returns the gateway intents the enabled features need. The
+// member cache wants the privileged GuildMembers intent but works without it.
+func (bot *Core) featureIntents() discordgo.Intent {
+	var intents discordgo.Intent
+	f := bot.features()
+	if f&(FeatureGuildCache|FeatureChannels|FeatureRoles) != 0 {
+		intents |= discordgo.IntentsGuilds
+	}
+	if f.Has(FeatureMembers) {
+		intents |= discordgo.IntentsGuildMembers
+	}
+	if f.Has(FeatureMessages) {
+		intents |= discordgo.IntentsGuildMessages | discordgo.IntentsGuildMessageReactions |
+			discordgo.IntentsGuildMessageTyping
+		if f.Has(FeaturePrivate) {
+			intents |= discordgo.IntentsDirectMessages | discordgo.IntentsDirectMessageReactions |
+				discordgo.IntentsDirectMessageTyping
+		}
+	}
+	return intents
+}
+
+// trimGuild drops the parts of a guild payload for caches that are disabled.
+// It returns a copy, the payload is shared with discordgo's State.
+func (bot *Core) trimGuild(guild *discordgo.Guild) *discordgo.Guild {
+	f := bot.features()
+	g := *guild
+	if !f.Has(FeatureChannels) {
+		g.Channels = nil
+	}
+	if !f.Has(FeatureRoles) {
+		g.Roles = nil
+	}
+	if !f.Has(FeatureMembers) {
+		g.Members = nil
+	}
+	return &g
+}
+
+// eventFeatures returns the features an event needs to be handled, events
+// without a feature are always handled.
+func eventFeatures(event interface{}) Features {
+	switch e := event.(type) {
+	case *discordgo.MessageCreate:
+		return messageFeatures(e.GuildID)
+	case *discordgo.MessageUpdate:
+		return messageFeatures(e.GuildID)
+	case *discordgo.MessageDelete:
+		return messageFeatures(e.GuildID)
+	case *discordgo.MessageDeleteBulk:
+		return messageFeatures(e.GuildID)
+	case *discordgo.MessageReactionAdd:
+		return messageFeatures(e.GuildID)
+	case *discordgo.MessageReactionRemove:
+		return messageFeatures(e.GuildID)
+	case *discordgo.MessageReactionRemoveAll:
+		return messageFeatures(e.GuildID)
+	case *discordgo.TypingStart:
+		return messageFeatures(e.GuildID)
+
+	case *discordgo.GuildMemberAdd, *discordgo.GuildMemberUpdate, *discordgo.GuildMemberRemove,
+		*discordgo.GuildMembersChunk, *discordgo.GuildBanAdd, *discordgo.GuildBanRemove,
+		*discordgo.PresenceUpdate:
+		return FeatureMembers
+
+	case *discordgo.ChannelCreate:
+		return channelFeatures(e.Channel)
+	case *discordgo.ChannelUpdate:
+		return channelFeatures(e.Channel)
+	case *discordgo.ChannelDelete:
+		return channelFeatures(e.Channel)
+	case *discordgo.ChannelPinsUpdate:
+		return FeatureChannels
+
+	case *discordgo.GuildRoleCreate, *discordgo.GuildRoleUpdate, *discordgo.GuildRoleDelete:
+		return FeatureRoles
+
+	case *discordgo.GuildCreate, *discordgo.GuildUpdate, *discordgo.GuildDelete:
+		return FeatureGuildCache
+	}
+	return FeaturesNone
+}
+
+func messageFeatures(gID string) Features {
+	if gID == "" {
+		return FeatureMessages | FeaturePrivate
+	}
+	return FeatureMessages
+}
+
+func channelFeatures(channel *discordgo.Channel) Features {
+	if isPrivate(channel) {
+		return FeaturePrivate
+	}
+	return FeatureChannels
+}
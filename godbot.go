@@ -1,38 +1,93 @@
 package godbot
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 // Error constants
 var (
-	_version      = "0.2.0"
+	_version      = "0.3.0"
 	ErrNilToken   = errors.New("token is not set")
-	ErrNilHandler = errors.New("message handler not assigned")
+	ErrNilHandler = errors.New("message handler not assigned") // Deprecated: handlers are optional.
+	ErrRunning    = errors.New("godbot: bot is already running")
 )
 
+// abortTimeout bounds how long a cancelled start waits on running handlers.
+const abortTimeout = 2 * time.Second
+
+// StartupPhase names the step of startup that failed.
+type StartupPhase string
+
+// Startup phases reported by StartupError.
+const (
+	PhaseOpen        StartupPhase = "opening gateway"
+	PhaseUser        StartupPhase = "fetching @me"
+	PhaseConnections StartupPhase = "updating connections"
+	PhaseStatus      StartupPhase = "updating status"
+	PhaseCommands    StartupPhase = "syncing application commands"
+)
+
+// StartupError is returned by Start when the bot could not become ready. Err
+// is the original error, so callers can use errors.Is and errors.As against it
+// (for example *discordgo.RESTError) to decide whether to retry.
+type StartupError struct {
+	Phase StartupPhase
+	Err   error
+}
+
+func (e *StartupError) Error() string {
+	return fmt.Sprintf("godbot: startup failed %s: %v", e.Phase, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *StartupError) Unwrap() error {
+	return e.Err
+}
+
 // New creates a new instance of the bot.
 func New(token string) (*Core, error) {
-	return &Core{Token: token, LiteMode: false}, nil
+	return &Core{Token: token, Features: FeaturesAll, Cache: NewMemoryCache()}, nil
 }
 
 // Start initiates the bot, attempts to connect to Discord.
 func (bot *Core) Start() error {
+	return bot.StartContext(context.Background())
+}
+
+// StartContext initiates the bot and waits for Discord to report ready. If ctx
+// is cancelled or expires before then, including while the gateway is still
+// connecting, the connection is torn down and the context's error is returned
+// without waiting on the ready handler for long.
+func (bot *Core) StartContext(ctx context.Context) error {
 	var err error
 
 	if bot.Token == "" {
 		return ErrNilToken
-	} else if !bot.LiteMode {
-		if bot.mch == nil {
-			return ErrNilHandler
-		} else if bot.muh == nil {
-			return ErrNilHandler
-		}
+	}
+
+	intents, err := bot.intents()
+	if err != nil {
+		return err
+	}
+
+	bot.muState.Lock()
+	if bot.running {
+		bot.muState.Unlock()
+		return ErrRunning
+	}
+	bot.running = true
+	bot.muState.Unlock()
+
+	if bot.Cache == nil {
+		bot.Cache = NewMemoryCache()
 	}
 
 	// Acknowledge the bot is starting.
@@ -40,84 +95,225 @@ func (bot *Core) Start() error {
 
 	err = bot.setupLogger()
 	if err != nil {
+		fmt.Println("Failed.")
+		bot.Shutdown(context.Background())
 		return err
 	}
 
 	bot.Session, err = discordgo.New("Bot " + bot.Token)
 	if err != nil {
+		fmt.Println("Failed.")
+		bot.Shutdown(context.Background())
 		return err
 	}
 
 	// Ready callback for when application is ready.
-	bot.ready = make(chan string)
+	bot.ready = make(chan error, 1)
 	bot.Ready = nil
-	bot.Session.AddHandler(bot.readyHandler)
 
-	if !bot.LiteMode {
-		// Message handler for MessageCreate and MessageUpdate
-		bot.Session.AddHandler(bot.mch)
-		bot.Session.AddHandler(bot.muh)
+	// Only ask for the events the features and handlers need.
+	bot.activeIntents = intents
+	bot.Session.Identify.Intents = discordgo.MakeIntent(intents)
 
-		// Handlers for channel changes
-		bot.Session.AddHandler(bot.channelCreated)
+	// Reconnecting is supervised by the bot so the cache can be resynced.
+	bot.Session.ShouldReconnectOnError = false
+	bot.stop = make(chan struct{})
+	bot.setConnectionState(StateConnecting)
 
-		// Channel Update Handler.
-		if bot.cuh != nil {
-			bot.Session.AddHandler(bot.cuh)
-		} else {
-			bot.Session.AddHandler(bot.channelUpdated)
+	// Every event is routed through dispatch so in-flight handlers can be
+	// drained on shutdown.
+	tracker := &handlerTracker{}
+	bot.inflight = tracker
+	bot.removeDispatch = bot.Session.AddHandler(func(s *discordgo.Session, event interface{}) {
+		if !tracker.begin() {
+			return
 		}
+		defer tracker.done()
+		bot.dispatch(s, event)
+	})
 
-		// Channel Delete Handler.
-		if bot.cdh != nil {
-			bot.Session.AddHandler(bot.cdh)
-		} else {
-			bot.Session.AddHandler(bot.channelDeleted)
+	// Open can hang on a dead gateway, it runs aside so ctx can cancel it.
+	opening := make(chan error, 1)
+	go func(s *discordgo.Session) {
+		opening <- s.Open()
+	}(bot.Session)
+
+	select {
+	case err = <-opening:
+		if err != nil {
+			fmt.Println("Failed.")
+			bot.errorlog(err)
+			bot.Shutdown(context.Background())
+			return &StartupError{Phase: PhaseOpen, Err: err}
 		}
+	case <-ctx.Done():
+		fmt.Println("Failed.")
+		bot.abortStart(opening)
+		return ctx.Err()
+	}
 
-		// Member handlers
-		bot.Session.AddHandler(bot.gmah)
-		bot.Session.AddHandler(bot.gmuh)
-		bot.Session.AddHandler(bot.gmrh)
+	// Wait for the ready to continue.
+	select {
+	case err = <-bot.ready:
+		if err != nil {
+			// Something wrong happened, returning the startup error.
+			fmt.Println("Failed.")
+			bot.Shutdown(context.Background())
+			return err
+		}
+		fmt.Println("ok")
 
-		// Guild operation handlers
-		bot.Session.AddHandler(bot.gah)
-		bot.Session.AddHandler(bot.gruh)
-		bot.Session.AddHandler(bot.grdh)
+		if bot.ReconcileInterval > 0 {
+			go bot.reconcileLoop(bot.ReconcileInterval, tracker, bot.stop)
+		}
+	case <-ctx.Done():
+		fmt.Println("Failed.")
+		bot.abortStart(nil)
+		return ctx.Err()
 	}
 
-	err = bot.Session.Open()
-	if err != nil {
-		bot.errorlog(err)
-		bot.Stop()
-		return err
+	return nil
+}
+
+// abortStart tears down a start cancelled by its context. The session is
+// closed before draining, and the ready handler's requests are waited on for
+// at most abortTimeout. A session still opening is closed once Open returns.
+func (bot *Core) abortStart(opening <-chan error) {
+	if !bot.beginShutdown() {
+		return
 	}
 
-	// Wait for the ready to continue.
-	for msg := range bot.ready {
-		// If the message is ok, return nil
-		if msg == "ok" {
-			fmt.Println(msg)
-			break
+	if s := bot.Session; s != nil {
+		if opening != nil {
+			go func() {
+				if <-opening == nil {
+					s.Close()
+				}
+			}()
 		} else {
-			// Something wrong happened, returning message.
-			fmt.Println("Failed.")
-			return errors.New(msg)
+			s.Close()
 		}
 	}
 
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+	if err := bot.drainHandlers(ctx); err != nil {
+		bot.errorlog(fmt.Errorf("godbot: aborting start: %v", err))
+	}
+	bot.closeLogger()
+	bot.setConnectionState(StateDisconnected)
 }
 
 // Stop shuts down the bot.
 func (bot *Core) Stop() error {
-	//bot.Unlock()
-	close(bot.ready)
-	bot.Session.Close()
-	return nil
+	return bot.Shutdown(context.Background())
+}
+
+// Shutdown stops the bot from receiving new events, waits for handlers that
+// are still running to return and then closes the session. If ctx is done
+// before the handlers finish, the session is closed anyway and the context's
+// error is returned. Calling Shutdown on a stopped bot does nothing.
+//
+// A handler that shuts the bot down must do so from a new goroutine, otherwise
+// Shutdown waits on the handler that called it.
+func (bot *Core) Shutdown(ctx context.Context) error {
+	if !bot.beginShutdown() {
+		return nil
+	}
+
+	err := bot.drainHandlers(ctx)
+	if bot.Session != nil {
+		if cerr := bot.Session.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	bot.closeLogger()
+	bot.setConnectionState(StateDisconnected)
+	return err
+}
+
+// beginShutdown marks the bot stopped and stops dispatching events, it
+// returns false if the bot was not running.
+func (bot *Core) beginShutdown() bool {
+	bot.muState.Lock()
+	if !bot.running {
+		bot.muState.Unlock()
+		return false
+	}
+	bot.running = false
+	bot.muState.Unlock()
+
+	bot.muConn.Lock()
+	if bot.stop != nil {
+		close(bot.stop)
+		bot.stop = nil
+	}
+	bot.muConn.Unlock()
+
+	if bot.removeDispatch != nil {
+		bot.removeDispatch()
+		bot.removeDispatch = nil
+	}
+	return true
+}
+
+// drainHandlers waits for the running handlers to return.
+func (bot *Core) drainHandlers(ctx context.Context) error {
+	if bot.inflight == nil {
+		return nil
+	}
+	err := bot.inflight.drain(ctx)
+	bot.inflight = nil
+	return err
+}
+
+// handlerTracker counts handler invocations that are still running.
+type handlerTracker struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// begin registers a new invocation, it returns false once draining started.
+func (t *handlerTracker) begin() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+func (t *handlerTracker) done() {
+	t.wg.Done()
+}
+
+// drain refuses new invocations and waits for the running ones to finish.
+func (t *handlerTracker) drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (bot *Core) setupLogger() error {
+	bot.muLog.Lock()
+	defer bot.muLog.Unlock()
+
 	bot.errlog = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
 
 	f, err := os.OpenFile("stderr.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
@@ -126,9 +322,20 @@ func (bot *Core) setupLogger() error {
 	}
 
 	bot.errlog.SetOutput(f)
+	bot.logFile = f
 	return nil
 }
 
+func (bot *Core) closeLogger() {
+	bot.muLog.Lock()
+	defer bot.muLog.Unlock()
+	if bot.logFile != nil {
+		bot.logFile.Close()
+		bot.logFile = nil
+		bot.errlog.SetOutput(os.Stderr)
+	}
+}
+
 func (bot *Core) errorlog(err error) {
 	bot.muLog.Lock()
 	defer bot.muLog.Unlock()
@@ -4,111 +4,337 @@ import "github.com/bwmarrin/discordgo"
 
 func (bot *Core) readyHandler(s *discordgo.Session, event *discordgo.Ready) {
 	bot.Lock()
-	defer bot.Unlock()
+	if bot.Ready != nil {
+		// A fresh session after a reconnect, the cached connections are stale.
+		bot.Ready = event
+		err := bot.resyncConnections()
+		bot.Unlock()
+		if err != nil {
+			bot.errorlog(err)
+		}
+		bot.setConnectionState(StateReady)
+		return
+	}
 
-	var err error
-	bot.User, err = s.User("@me")
+	err := bot.startupReady(s, event)
+	bot.Unlock()
 	if err != nil {
 		bot.errorlog(err)
-		bot.ready <- err.Error()
+		bot.signalReady(err)
 		return
 	}
 
+	bot.setConnectionState(StateReady)
+	bot.signalReady(nil)
+}
+
+// startupReady loads everything the bot needs on its first READY.
+func (bot *Core) startupReady(s *discordgo.Session, event *discordgo.Ready) error {
+	var err error
+	bot.User, err = s.User("@me")
+	if err != nil {
+		return &StartupError{Phase: PhaseUser, Err: err}
+	}
+
 	err = bot.UpdateConnections()
 	if err != nil {
-		bot.errorlog(err)
-		bot.ready <- err.Error()
-		return
+		return &StartupError{Phase: PhaseConnections, Err: err}
 	}
 
-	bot.GuildMain = bot.Guilds[0]
-	bot.ChannelMain = bot.GetMainChannel(bot.GuildMain.ID)
+	if guilds := bot.Guilds(); len(guilds) > 0 {
+		bot.GuildMain = guilds[0]
+		bot.ChannelMain = bot.GetMainChannel(bot.GuildMain.ID)
+	}
 
 	if bot.Game != "" {
-		err = s.UpdateStatus(0, bot.Game)
+		err = s.UpdateGameStatus(0, bot.Game)
 		if err != nil {
-			bot.errorlog(err)
-			bot.ready <- err.Error()
-			return
+			return &StartupError{Phase: PhaseStatus, Err: err}
 		}
 	}
 
-	if bot.Ready == nil {
-		bot.Ready = event
-		bot.ready <- "ok"
+	if err = bot.SyncSlashCommands(); err != nil {
+		return &StartupError{Phase: PhaseCommands, Err: err}
+	}
+
+	if err = bot.ResumeLocks(); err != nil {
+		bot.errorlog(err)
+	}
+
+	bot.Ready = event
+	return nil
+}
+
+// signalReady reports the startup result without blocking, a READY received
+// after startup has nobody waiting on it. A nil error means the bot is ready.
+func (bot *Core) signalReady(err error) {
+	select {
+	case bot.ready <- err:
+	default:
 	}
 }
 
+// dispatch keeps the bot's own state current and then publishes the event to
+// every subscribed handler. Events for disabled features are dropped.
+func (bot *Core) dispatch(s *discordgo.Session, event interface{}) {
+	if !bot.features().Has(eventFeatures(event)) {
+		return
+	}
+
+	switch e := event.(type) {
+	case *discordgo.Ready:
+		bot.readyHandler(s, e)
+	case *discordgo.Resumed:
+		bot.setConnectionState(StateReady)
+	case *discordgo.Disconnect:
+		bot.setConnectionState(StateDisconnected)
+
+	// Channel cache.
+	case *discordgo.ChannelCreate:
+		bot.channelCreated(s, e)
+	case *discordgo.ChannelUpdate:
+		bot.channelUpdated(s, e)
+	case *discordgo.ChannelDelete:
+		bot.channelDeleted(s, e)
+
+	// Guild and role cache.
+	case *discordgo.GuildCreate:
+		bot.guildCreated(s, e)
+	case *discordgo.GuildDelete:
+		bot.guildDeleted(s, e)
+	case *discordgo.GuildRoleCreate:
+		bot.roleCreated(s, e)
+	case *discordgo.GuildRoleUpdate:
+		bot.roleUpdated(s, e)
+	case *discordgo.GuildRoleDelete:
+		bot.roleDeleted(s, e)
+
+	// Member cache.
+	case *discordgo.GuildMemberAdd:
+		bot.memberAdded(s, e)
+	case *discordgo.GuildMemberUpdate:
+		bot.memberUpdated(s, e)
+	case *discordgo.GuildMemberRemove:
+		bot.memberRemoved(s, e)
+	case *discordgo.GuildMembersChunk:
+		bot.membersChunk(s, e)
+	}
+
+	if !bot.LiteMode {
+		bot.publishEvent(s, event)
+	}
+
+	// Reconnecting blocks until the session is open again.
+	if _, ok := event.(*discordgo.Disconnect); ok {
+		bot.reconnect(s)
+	}
+}
+
+// ReconcileHandler assigns a function called when a periodic reconciliation
+// corrected drift in the connection cache.
+func (bot *Core) ReconcileHandler(driftHandler func(*Drift)) {
+	bot.rch = driftHandler
+}
+
+// ConnectionStateHandler assigns a function called whenever the connection
+// state changes, for example when the gateway drops and is resumed.
+func (bot *Core) ConnectionStateHandler(stateHandler func(old, new ConnectionState)) {
+	bot.muConn.Lock()
+	defer bot.muConn.Unlock()
+	bot.csh = stateHandler
+}
+
 // MessageCreateHandler assigns a function to handle messages.
 func (bot *Core) MessageCreateHandler(msgHandler func(*discordgo.Session, *discordgo.MessageCreate)) {
-	bot.mch = msgHandler
+	bot.setHandler("MessageCreate", msgHandler)
 }
 
 // MessageUpdateHandler assigns a function to handle messages.
 func (bot *Core) MessageUpdateHandler(msgHandler func(*discordgo.Session, *discordgo.MessageUpdate)) {
-	bot.muh = msgHandler
+	bot.setHandler("MessageUpdate", msgHandler)
 }
 
 // GuildMemberAddHandler assigns a function to deal with newly joining users.
 func (bot *Core) GuildMemberAddHandler(userHandler func(*discordgo.Session, *discordgo.GuildMemberAdd)) {
-	bot.gmah = userHandler
+	bot.setHandler("GuildMemberAdd", userHandler)
 }
 
 // GuildMemberUpdateHandler assigns a function to deal with updating users.
 func (bot *Core) GuildMemberUpdateHandler(userHandler func(*discordgo.Session, *discordgo.GuildMemberUpdate)) {
-	bot.gmuh = userHandler
+	bot.setHandler("GuildMemberUpdate", userHandler)
 }
 
 // GuildMemberRemoveHandler assigns a function to deal with leaving users.
 func (bot *Core) GuildMemberRemoveHandler(userHandler func(*discordgo.Session, *discordgo.GuildMemberRemove)) {
-	bot.gmrh = userHandler
+	bot.setHandler("GuildMemberRemove", userHandler)
 }
 
 // GuildCreateHandler assigns a function to deal with newly create guilds.
 func (bot *Core) GuildCreateHandler(createHandler func(*discordgo.Session, *discordgo.GuildCreate)) {
-	bot.gah = createHandler
+	bot.setHandler("GuildCreate", createHandler)
 }
 
-// ChannelUpdateHandler for any events that update a channel.
+// ChannelUpdateHandler for any events that update a channel, it is called after
+// the channel in memory has been updated.
 func (bot *Core) ChannelUpdateHandler(channelHandler func(*discordgo.Session, *discordgo.ChannelUpdate)) {
-	bot.cuh = channelHandler
+	bot.setHandler("ChannelUpdate", channelHandler)
 }
 
-// ChannelDeleteHandler for an event where a channel is removed from a guild.
+// ChannelDeleteHandler for an event where a channel is removed from a guild, it
+// is called after the channel has been removed from memory.
 func (bot *Core) ChannelDeleteHandler(channelHandler func(*discordgo.Session, *discordgo.ChannelDelete)) {
-	bot.cdh = channelHandler
+	bot.setHandler("ChannelDelete", channelHandler)
+}
+
+// GuildRoleCreateHandler will process roles created in a guild.
+func (bot *Core) GuildRoleCreateHandler(createHandler func(*discordgo.Session, *discordgo.GuildRoleCreate)) {
+	bot.setHandler("GuildRoleCreate", createHandler)
 }
 
 // GuildRoleUpdateHandler will process new updates for guild roles.
 func (bot *Core) GuildRoleUpdateHandler(updateHandler func(*discordgo.Session, *discordgo.GuildRoleUpdate)) {
-	bot.gruh = updateHandler
+	bot.setHandler("GuildRoleUpdate", updateHandler)
 }
 
 // GuildRoleDeleteHandler checks if guild roles are removed.
 func (bot *Core) GuildRoleDeleteHandler(deleteHandler func(*discordgo.Session, *discordgo.GuildRoleDelete)) {
-	bot.grdh = deleteHandler
+	bot.setHandler("GuildRoleDelete", deleteHandler)
+}
+
+// MessageDeleteHandler assigns a function to handle deleted messages.
+func (bot *Core) MessageDeleteHandler(msgHandler func(*discordgo.Session, *discordgo.MessageDelete)) {
+	bot.setHandler("MessageDelete", msgHandler)
+}
+
+// MessageDeleteBulkHandler assigns a function to handle messages deleted in bulk.
+func (bot *Core) MessageDeleteBulkHandler(msgHandler func(*discordgo.Session, *discordgo.MessageDeleteBulk)) {
+	bot.setHandler("MessageDeleteBulk", msgHandler)
+}
+
+// MessageReactionAddHandler assigns a function to handle reactions added to a message.
+func (bot *Core) MessageReactionAddHandler(reactionHandler func(*discordgo.Session, *discordgo.MessageReactionAdd)) {
+	bot.setHandler("MessageReactionAdd", reactionHandler)
+}
+
+// MessageReactionRemoveHandler assigns a function to handle reactions removed from a message.
+func (bot *Core) MessageReactionRemoveHandler(reactionHandler func(*discordgo.Session, *discordgo.MessageReactionRemove)) {
+	bot.setHandler("MessageReactionRemove", reactionHandler)
+}
+
+// MessageReactionRemoveAllHandler assigns a function to handle every reaction being removed from a message.
+func (bot *Core) MessageReactionRemoveAllHandler(reactionHandler func(*discordgo.Session, *discordgo.MessageReactionRemoveAll)) {
+	bot.setHandler("MessageReactionRemoveAll", reactionHandler)
+}
+
+// TypingStartHandler assigns a function to handle users that start typing.
+func (bot *Core) TypingStartHandler(typingHandler func(*discordgo.Session, *discordgo.TypingStart)) {
+	bot.setHandler("TypingStart", typingHandler)
+}
+
+// PresenceUpdateHandler assigns a function to handle changes to a user's presence.
+func (bot *Core) PresenceUpdateHandler(presenceHandler func(*discordgo.Session, *discordgo.PresenceUpdate)) {
+	bot.setHandler("PresenceUpdate", presenceHandler)
+}
+
+// VoiceStateUpdateHandler assigns a function to handle users joining, leaving or changing voice state.
+func (bot *Core) VoiceStateUpdateHandler(voiceHandler func(*discordgo.Session, *discordgo.VoiceStateUpdate)) {
+	bot.setHandler("VoiceStateUpdate", voiceHandler)
+}
+
+// GuildBanAddHandler assigns a function to handle users banned from a guild.
+func (bot *Core) GuildBanAddHandler(banHandler func(*discordgo.Session, *discordgo.GuildBanAdd)) {
+	bot.setHandler("GuildBanAdd", banHandler)
+}
+
+// GuildBanRemoveHandler assigns a function to handle users unbanned from a guild.
+func (bot *Core) GuildBanRemoveHandler(banHandler func(*discordgo.Session, *discordgo.GuildBanRemove)) {
+	bot.setHandler("GuildBanRemove", banHandler)
+}
+
+// GuildUpdateHandler assigns a function to handle guild modifications.
+func (bot *Core) GuildUpdateHandler(updateHandler func(*discordgo.Session, *discordgo.GuildUpdate)) {
+	bot.setHandler("GuildUpdate", updateHandler)
+}
+
+// GuildDeleteHandler assigns a function to handle guilds the bot left or that became unavailable.
+func (bot *Core) GuildDeleteHandler(deleteHandler func(*discordgo.Session, *discordgo.GuildDelete)) {
+	bot.setHandler("GuildDelete", deleteHandler)
+}
+
+// ChannelCreateHandler for an event where a channel is added to a guild, it is called after
+// the channel has been added to memory.
+func (bot *Core) ChannelCreateHandler(channelHandler func(*discordgo.Session, *discordgo.ChannelCreate)) {
+	bot.setHandler("ChannelCreate", channelHandler)
 }
 
 func (bot *Core) channelCreated(s *discordgo.Session, cc *discordgo.ChannelCreate) {
-	err := bot.UpdateConnections()
-	if err != nil {
-		bot.errorlog(err)
-		return
-	}
+	bot.ChannelMemoryAdd(cc.Channel)
 }
 
 func (bot *Core) channelDeleted(s *discordgo.Session, cd *discordgo.ChannelDelete) {
-	err := bot.UpdateConnections()
-	if err != nil {
-		bot.errorlog(err)
+	bot.ChannelMemoryDelete(cd.Channel)
+}
+
+func (bot *Core) channelUpdated(s *discordgo.Session, cu *discordgo.ChannelUpdate) {
+	bot.ChannelMemoryAdd(cu.Channel)
+}
+
+func (bot *Core) guildCreated(s *discordgo.Session, gc *discordgo.GuildCreate) {
+	bot.Cache.SetGuild(bot.trimGuild(gc.Guild))
+
+	// Fill the member cache once the guild is available, listing every member
+	// needs the privileged GuildMembers intent.
+	if bot.features().Has(FeatureMembers) && bot.activeIntents&discordgo.IntentsGuildMembers != 0 {
+		bot.requestMembers(gc.ID)
+	}
+}
+
+func (bot *Core) guildDeleted(s *discordgo.Session, gd *discordgo.GuildDelete) {
+	// Unavailable guilds are in an outage, the bot has not left them.
+	if gd.Unavailable {
 		return
 	}
+	bot.Cache.DeleteGuild(gd.ID)
 }
 
-func (bot *Core) channelUpdated(s *discordgo.Session, cu *discordgo.ChannelUpdate) {
-	err := bot.UpdateConnections()
-	if err != nil {
-		bot.errorlog(err)
+func (bot *Core) roleCreated(s *discordgo.Session, rc *discordgo.GuildRoleCreate) {
+	bot.Cache.SetRole(rc.GuildID, rc.Role)
+}
+
+func (bot *Core) roleUpdated(s *discordgo.Session, ru *discordgo.GuildRoleUpdate) {
+	bot.Cache.SetRole(ru.GuildID, ru.Role)
+}
+
+func (bot *Core) roleDeleted(s *discordgo.Session, rd *discordgo.GuildRoleDelete) {
+	bot.Cache.DeleteRole(rd.GuildID, rd.RoleID)
+}
+
+func (bot *Core) memberAdded(s *discordgo.Session, ma *discordgo.GuildMemberAdd) {
+	bot.Cache.SetMember(ma.GuildID, ma.Member)
+}
+
+func (bot *Core) memberUpdated(s *discordgo.Session, mu *discordgo.GuildMemberUpdate) {
+	bot.Cache.SetMember(mu.GuildID, mu.Member)
+}
+
+func (bot *Core) memberRemoved(s *discordgo.Session, mr *discordgo.GuildMemberRemove) {
+	if mr.User == nil {
 		return
 	}
+	bot.Cache.DeleteMember(mr.GuildID, mr.User.ID)
+}
+
+func (bot *Core) membersChunk(s *discordgo.Session, mc *discordgo.GuildMembersChunk) {
+	for _, m := range mc.Members {
+		bot.Cache.SetMember(mc.GuildID, m)
+	}
+
+	if mc.ChunkIndex == mc.ChunkCount-1 {
+		bot.muMembers.Lock()
+		if bot.membersLoaded == nil {
+			bot.membersLoaded = make(map[string]bool)
+		}
+		bot.membersLoaded[mc.GuildID] = true
+		bot.muMembers.Unlock()
+	}
 }
@@ -0,0 +1,232 @@
+package godbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Embed limits enforced by discord.
+const (
+	embedFieldLimit       = 25
+	embedDescriptionLimit = 4096
+	embedValueLimit       = 1024
+	embedTotalLimit       = 6000
+)
+
+// helpColor is the color of help embeds, the same as lock notices.
+const helpColor = 0x800000
+
+// Category commands without one are listed under.
+const defaultCategory = "General"
+
+// MarshalText encodes the type by name.
+func (t ArgType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// JSON encodes every command of the registry, sorted by name, for use by
+// documentation. Required permissions are listed by name.
+func (reg *Registry) JSON() ([]byte, error) {
+	type command struct {
+		*Command
+		Category    string   `json:"category"`
+		Permissions []string `json:"permissions,omitempty"`
+	}
+
+	cmds := reg.Commands()
+	out := make([]command, len(cmds))
+	for n, cmd := range cmds {
+		out[n] = command{Command: cmd, Category: cmd.category()}
+		if cmd.Permissions != 0 {
+			out[n].Permissions = strings.Split(PermissionString(cmd.Permissions), ", ")
+		}
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// Categories returns the commands grouped by category, hidden commands and
+// commands rejected by filter are left out. A nil filter keeps every command.
+func (reg *Registry) Categories(filter func(*Command) bool) map[string][]*Command {
+	groups := make(map[string][]*Command)
+	for _, cmd := range reg.Commands() {
+		if cmd.Hidden || (filter != nil && !filter(cmd)) {
+			continue
+		}
+		groups[cmd.category()] = append(groups[cmd.category()], cmd)
+	}
+	return groups
+}
+
+// HelpEmbeds lists the commands passing filter as embeds, one field per
+// category. The list is split into as many embeds as discord's limits need,
+// each numbered in its footer.
+func (reg *Registry) HelpEmbeds(prefix string, filter func(*Command) bool) []*discordgo.MessageEmbed {
+	groups := reg.Categories(filter)
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Split each category into fields that fit the value limit.
+	var fields []*discordgo.MessageEmbedField
+	for _, name := range names {
+		var value string
+		title := name
+		for _, cmd := range groups[name] {
+			line := fmt.Sprintf("`%s%s`", prefix, cmd.Name)
+			if cmd.Help != "" {
+				line += " - " + firstLine(cmd.Help)
+			}
+			if len(line) > embedValueLimit {
+				line = line[:embedValueLimit-3] + "..."
+			}
+
+			if len(value)+len(line)+1 > embedValueLimit {
+				fields = append(fields, &discordgo.MessageEmbedField{Name: title, Value: value})
+				title, value = name+" (cont.)", ""
+			}
+			if value != "" {
+				value += "\n"
+			}
+			value += line
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{Name: title, Value: value})
+	}
+
+	footer := fmt.Sprintf("Use %shelp <command> for details.", prefix)
+	var embeds []*discordgo.MessageEmbed
+	var em *discordgo.MessageEmbed
+	var size int
+	for _, f := range fields {
+		n := len(f.Name) + len(f.Value)
+		if em == nil || len(em.Fields) == embedFieldLimit || size+n > embedTotalLimit-len(footer)-100 {
+			em = &discordgo.MessageEmbed{
+				Title: "Commands",
+				Color: helpColor,
+			}
+			embeds = append(embeds, em)
+			size = len(em.Title)
+		}
+		em.Fields = append(em.Fields, f)
+		size += n
+	}
+
+	if len(embeds) == 0 {
+		embeds = append(embeds, &discordgo.MessageEmbed{
+			Title:       "Commands",
+			Color:       helpColor,
+			Description: "No commands available.",
+		})
+	}
+	for n, em := range embeds {
+		text := footer
+		if len(embeds) > 1 {
+			text = fmt.Sprintf("Page %d/%d. %s", n+1, len(embeds), footer)
+		}
+		em.Footer = &discordgo.MessageEmbedFooter{Text: text}
+	}
+	return embeds
+}
+
+// CommandEmbed describes a single command: its usage, help, aliases and the
+// permissions it requires.
+func CommandEmbed(prefix string, cmd *Command) *discordgo.MessageEmbed {
+	em := &discordgo.MessageEmbed{
+		Title:       cmd.Usage(prefix),
+		Color:       helpColor,
+		Description: cmd.Help,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Category", Value: cmd.category(), Inline: true},
+		},
+	}
+
+	if len(cmd.Aliases) > 0 {
+		em.Fields = append(em.Fields, &discordgo.MessageEmbedField{
+			Name: "Aliases", Value: strings.Join(cmd.Aliases, ", "), Inline: true,
+		})
+	}
+	if cmd.Permissions != 0 {
+		em.Fields = append(em.Fields, &discordgo.MessageEmbedField{
+			Name: "Permissions", Value: PermissionString(cmd.Permissions), Inline: true,
+		})
+	}
+
+	var args []string
+	for _, a := range cmd.Args {
+		if a.Help != "" {
+			args = append(args, fmt.Sprintf("`%s` - %s", a.Name, a.Help))
+		}
+	}
+	if len(args) > 0 {
+		em.Fields = append(em.Fields, &discordgo.MessageEmbedField{
+			Name: "Arguments", Value: strings.Join(args, "\n"),
+		})
+	}
+	return em
+}
+
+// HelpCommand creates a help command for the router. Without arguments it
+// lists the commands the invoker can run, otherwise it describes one.
+// Register it like any other command.
+func (r *Router) HelpCommand() *Command {
+	return &Command{
+		Name:    "help",
+		Aliases: []string{"commands"},
+		Help:    "Lists commands or describes one.",
+		Args: []Arg{
+			{Name: "command", Help: "Command to describe.", Optional: true},
+		},
+		Handler: func(ctx *Context) error {
+			filter := func(cmd *Command) bool { return ctx.CanRun(cmd) }
+
+			if name := ctx.ArgString("command"); name != "" {
+				cmd := r.Command(name)
+				if cmd == nil || cmd.Hidden || !filter(cmd) {
+					_, err := ctx.Reply(fmt.Sprintf("No command named `%s`.", name))
+					return err
+				}
+				_, err := ctx.Session.ChannelMessageSendEmbed(ctx.Message.ChannelID, CommandEmbed(ctx.Prefix, cmd))
+				return err
+			}
+
+			for _, em := range r.registry.HelpEmbeds(ctx.Prefix, filter) {
+				if _, err := ctx.Session.ChannelMessageSendEmbed(ctx.Message.ChannelID, em); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// CanRun checks if the invoker has the permissions the command requires in
+// the channel. Commands requiring permissions can not run in private messages.
+func (ctx *Context) CanRun(cmd *Command) bool {
+	if cmd.Permissions == 0 {
+		return true
+	} else if ctx.Guild == nil {
+		return false
+	}
+
+	ok, err := ctx.Core.HasPermissions(ctx.Message.ChannelID, ctx.Author.ID, cmd.Permissions)
+	return err == nil && ok
+}
+
+func (cmd *Command) category() string {
+	if cmd.Category == "" {
+		return defaultCategory
+	}
+	return cmd.Category
+}
+
+func firstLine(s string) string {
+	if n := strings.IndexByte(s, '\n'); n >= 0 {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,183 @@
+package godbot
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// IntentMessageContent allows reading the content of messages that do not
+// mention the bot. It is newer than some discordgo releases, so it is defined
+// here. Only request it from gateways that support it.
+const IntentMessageContent discordgo.Intent = 1 << 15
+
+// PrivilegedIntents must be enabled for the application in the developer
+// portal and are never requested unless asked for.
+const PrivilegedIntents = discordgo.IntentsGuildMembers | discordgo.IntentsGuildPresences | IntentMessageContent
+
+// IntentError is returned by Start when a handler needs a privileged intent
+// that was not requested.
+type IntentError struct {
+	Event   string           // Event the handler is subscribed to, "Router" for the command router.
+	Missing discordgo.Intent // Privileged intents that were not requested.
+}
+
+func (e *IntentError) Error() string {
+	return fmt.Sprintf("godbot: %s handler needs privileged intents that were not requested: %s",
+		e.Event, IntentString(e.Missing))
+}
+
+// eventIntents maps events to the intents that deliver them. Events are keyed
+// by name so ones missing from older discordgo releases are still covered.
+var eventIntents = map[string]discordgo.Intent{
+	"ChannelCreate":            discordgo.IntentsGuilds,
+	"ChannelUpdate":            discordgo.IntentsGuilds,
+	"ChannelDelete":            discordgo.IntentsGuilds,
+	"ChannelPinsUpdate":        discordgo.IntentsGuilds,
+	"GuildCreate":              discordgo.IntentsGuilds,
+	"GuildUpdate":              discordgo.IntentsGuilds,
+	"GuildDelete":              discordgo.IntentsGuilds,
+	"GuildRoleCreate":          discordgo.IntentsGuilds,
+	"GuildRoleUpdate":          discordgo.IntentsGuilds,
+	"GuildRoleDelete":          discordgo.IntentsGuilds,
+	"ThreadCreate":             discordgo.IntentsGuilds,
+	"ThreadUpdate":             discordgo.IntentsGuilds,
+	"ThreadDelete":             discordgo.IntentsGuilds,
+	"ThreadListSync":           discordgo.IntentsGuilds,
+	"ThreadMemberUpdate":       discordgo.IntentsGuilds,
+	"ThreadMembersUpdate":      discordgo.IntentsGuilds | discordgo.IntentsGuildMembers,
+	"GuildMemberAdd":           discordgo.IntentsGuildMembers,
+	"GuildMemberUpdate":        discordgo.IntentsGuildMembers,
+	"GuildMemberRemove":        discordgo.IntentsGuildMembers,
+	"GuildBanAdd":              discordgo.IntentsGuildBans,
+	"GuildBanRemove":           discordgo.IntentsGuildBans,
+	"GuildEmojisUpdate":        discordgo.IntentsGuildEmojis,
+	"GuildIntegrationsUpdate":  discordgo.IntentsGuildIntegrations,
+	"WebhooksUpdate":           discordgo.IntentsGuildWebhooks,
+	"InviteCreate":             discordgo.IntentsGuildInvites,
+	"InviteDelete":             discordgo.IntentsGuildInvites,
+	"VoiceStateUpdate":         discordgo.IntentsGuildVoiceStates,
+	"PresenceUpdate":           discordgo.IntentsGuildPresences,
+	"MessageCreate":            discordgo.IntentsGuildMessages,
+	"MessageUpdate":            discordgo.IntentsGuildMessages,
+	"MessageDelete":            discordgo.IntentsGuildMessages,
+	"MessageDeleteBulk":        discordgo.IntentsGuildMessages,
+	"MessageReactionAdd":       discordgo.IntentsGuildMessageReactions,
+	"MessageReactionRemove":    discordgo.IntentsGuildMessageReactions,
+	"MessageReactionRemoveAll": discordgo.IntentsGuildMessageReactions,
+	"TypingStart":              discordgo.IntentsGuildMessageTyping,
+}
+
+// intentNames names every intent bit for IntentString.
+var intentNames = map[discordgo.Intent]string{
+	discordgo.IntentsGuilds:                 "Guilds",
+	discordgo.IntentsGuildMembers:           "GuildMembers",
+	discordgo.IntentsGuildBans:              "GuildBans",
+	discordgo.IntentsGuildEmojis:            "GuildEmojis",
+	discordgo.IntentsGuildIntegrations:      "GuildIntegrations",
+	discordgo.IntentsGuildWebhooks:          "GuildWebhooks",
+	discordgo.IntentsGuildInvites:           "GuildInvites",
+	discordgo.IntentsGuildVoiceStates:       "GuildVoiceStates",
+	discordgo.IntentsGuildPresences:         "GuildPresences",
+	discordgo.IntentsGuildMessages:          "GuildMessages",
+	discordgo.IntentsGuildMessageReactions:  "GuildMessageReactions",
+	discordgo.IntentsGuildMessageTyping:     "GuildMessageTyping",
+	discordgo.IntentsDirectMessages:         "DirectMessages",
+	discordgo.IntentsDirectMessageReactions: "DirectMessageReactions",
+	discordgo.IntentsDirectMessageTyping:    "DirectMessageTyping",
+	IntentMessageContent:                    "MessageContent",
+}
+
+// IntentString lists the names of the intents set, separated by "|".
+func IntentString(intents discordgo.Intent) string {
+	var names []string
+	for bit := discordgo.Intent(1); bit <= intents && bit > 0; bit <<= 1 {
+		if intents&bit == 0 {
+			continue
+		}
+		if name, ok := intentNames[bit]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("1<<%d", bitIndex(uint64(bit))))
+		}
+	}
+	if len(names) == 0 {
+		return "None"
+	}
+	return strings.Join(names, "|")
+}
+
+// RequiredIntents returns the intents the enabled features and subscribed
+// handlers need, including privileged ones.
+func (bot *Core) RequiredIntents() discordgo.Intent {
+	intents := bot.featureIntents()
+	for _, name := range bot.bus.eventNames() {
+		intents |= eventIntents[name]
+	}
+	if r := bot.Router(); r != nil && r.needsContent() {
+		intents |= IntentMessageContent
+	}
+	return intents
+}
+
+// intents works out the intents to identify with. An explicit Intents value is
+// used as is, otherwise the required intents without the privileged ones are
+// combined with RequestPrivileged. It fails when a handler needs a privileged
+// intent that is not part of the result.
+func (bot *Core) intents() (discordgo.Intent, error) {
+	requested := bot.Intents
+	if requested == 0 {
+		requested = bot.RequiredIntents()&^PrivilegedIntents | bot.RequestPrivileged
+	}
+
+	for _, name := range bot.bus.eventNames() {
+		missing := eventIntents[name] & PrivilegedIntents &^ requested
+		if missing != 0 {
+			return 0, &IntentError{Event: name, Missing: missing}
+		}
+	}
+
+	// Prefixed commands in guild messages arrive with empty content without it.
+	r := bot.Router()
+	if r != nil && r.needsContent() && requested&discordgo.IntentsGuildMessages != 0 &&
+		requested&IntentMessageContent == 0 {
+		return 0, &IntentError{Event: "Router", Missing: IntentMessageContent}
+	}
+	return requested, nil
+}
+
+// eventNames returns the names of the event types that have handlers, sorted.
+func (b *eventBus) eventNames() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var names []string
+	for t, subs := range b.handlers {
+		if len(subs) == 0 || t == interfaceType {
+			continue
+		}
+		names = append(names, eventName(t))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// eventName returns the name of an event type such as *discordgo.MessageCreate.
+func eventName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+func bitIndex(bit uint64) int {
+	var n int
+	for bit > 1 {
+		bit >>= 1
+		n++
+	}
+	return n
+}
@@ -0,0 +1,155 @@
+package godbot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestIntents(t *testing.T) {
+	const (
+		guilds   = discordgo.IntentsGuilds
+		members  = discordgo.IntentsGuildMembers
+		messages = discordgo.IntentsGuildMessages
+		presence = discordgo.IntentsGuildPresences
+		typing   = discordgo.IntentsGuildMessageTyping
+		react    = discordgo.IntentsGuildMessageReactions
+		direct   = discordgo.IntentsDirectMessages | discordgo.IntentsDirectMessageReactions | discordgo.IntentsDirectMessageTyping
+	)
+	onMember := func(*discordgo.Session, *discordgo.GuildMemberAdd) {}
+	onPresence := func(*discordgo.Session, *discordgo.PresenceUpdate) {}
+	onMessage := func(*discordgo.Session, *discordgo.MessageCreate) {}
+	onInvite := func(*discordgo.Session, *discordgo.InviteCreate) {}
+	onAny := func(*discordgo.Session, interface{}) {}
+
+	tests := []struct {
+		name       string
+		features   Features
+		handlers   []interface{}
+		router     *Router
+		intents    discordgo.Intent // Core.Intents.
+		privileged discordgo.Intent // Core.RequestPrivileged.
+		required   discordgo.Intent
+		want       discordgo.Intent
+		err        *IntentError
+	}{
+		{
+			name:     "no features and no handlers",
+			required: 0,
+			want:     0,
+		},
+		{
+			name:     "every feature leaves out privileged intents",
+			features: FeaturesAll,
+			required: guilds | members | messages | react | typing | direct,
+			want:     guilds | messages | react | typing | direct,
+		},
+		{
+			name:     "private messages need the messages feature",
+			features: FeaturePrivate,
+			required: 0,
+			want:     0,
+		},
+		{
+			name:     "roles need guilds",
+			features: FeatureRoles,
+			required: guilds,
+			want:     guilds,
+		},
+		{
+			name:     "handlers add their event's intent",
+			handlers: []interface{}{onInvite, onMessage, onAny},
+			required: discordgo.IntentsGuildInvites | messages,
+			want:     discordgo.IntentsGuildInvites | messages,
+		},
+		{
+			name:     "privileged handler fails without the intent",
+			handlers: []interface{}{onMember},
+			required: members,
+			err:      &IntentError{Event: "GuildMemberAdd", Missing: members},
+		},
+		{
+			name:       "privileged handler with the intent requested",
+			handlers:   []interface{}{onMember, onPresence},
+			privileged: members | presence,
+			required:   members | presence,
+			want:       members | presence,
+		},
+		{
+			name:     "explicit intents are used as is",
+			features: FeaturesAll,
+			intents:  guilds | presence,
+			handlers: []interface{}{onPresence},
+			required: guilds | members | messages | react | typing | direct | presence,
+			want:     guilds | presence,
+		},
+		{
+			name:     "explicit intents missing a privileged one",
+			intents:  guilds,
+			handlers: []interface{}{onPresence},
+			required: presence,
+			err:      &IntentError{Event: "PresenceUpdate", Missing: presence},
+		},
+		{
+			name:     "prefixed router needs message content",
+			features: FeatureMessages,
+			router:   NewRouter("!"),
+			required: messages | react | typing | IntentMessageContent,
+			err:      &IntentError{Event: "Router", Missing: IntentMessageContent},
+		},
+		{
+			name:       "prefixed router with message content",
+			features:   FeatureMessages,
+			router:     NewRouter("!"),
+			privileged: IntentMessageContent,
+			required:   messages | react | typing | IntentMessageContent,
+			want:       messages | react | typing | IntentMessageContent,
+		},
+		{
+			name:     "mention only router does not",
+			features: FeatureMessages,
+			router:   NewRouter(""),
+			required: messages | react | typing,
+			want:     messages | react | typing,
+		},
+		{
+			name:     "prefixed router without guild messages",
+			router:   NewRouter("!"),
+			intents:  discordgo.IntentsDirectMessages,
+			required: messages | IntentMessageContent,
+			want:     discordgo.IntentsDirectMessages,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &Core{Features: tt.features, Intents: tt.intents, RequestPrivileged: tt.privileged}
+			for _, h := range tt.handlers {
+				if _, err := bot.AddHandler(h); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.router != nil {
+				bot.UseRouter(tt.router)
+			}
+
+			if got := bot.RequiredIntents(); got != tt.required {
+				t.Errorf("required %s, want %s", IntentString(got), IntentString(tt.required))
+			}
+
+			got, err := bot.intents()
+			var ie *IntentError
+			switch {
+			case tt.err == nil && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != nil && !errors.As(err, &ie):
+				t.Errorf("got error %v, want %v", err, tt.err)
+			case tt.err != nil && *ie != *tt.err:
+				t.Errorf("got error %v, want %v", ie, tt.err)
+			case tt.err == nil && got != tt.want:
+				t.Errorf("got %s, want %s", IntentString(got), IntentString(tt.want))
+			}
+		})
+	}
+}
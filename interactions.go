@@ -0,0 +1,112 @@
+package godbot
+
+import (
+	"errors"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ErrAlreadyResponded is returned when answering an interaction twice.
+var ErrAlreadyResponded = errors.New("godbot: interaction already responded to")
+
+// InteractionContext answers an interaction, it is shared by slash commands
+// and components.
+type InteractionContext struct {
+	Core        *Core
+	Session     *discordgo.Session
+	Interaction *discordgo.Interaction
+
+	responded bool
+	deferred  bool
+}
+
+// User returns the user that caused the interaction.
+func (ctx *InteractionContext) User() *discordgo.User {
+	if ctx.Interaction.Member != nil {
+		return ctx.Interaction.Member.User
+	}
+	return ctx.Interaction.User
+}
+
+// Respond answers the interaction with a message.
+func (ctx *InteractionContext) Respond(content string) error {
+	return ctx.respond(discordgo.InteractionResponseChannelMessageWithSource,
+		&discordgo.InteractionResponseData{Content: content})
+}
+
+// RespondEphemeral answers with a message only the user can see.
+func (ctx *InteractionContext) RespondEphemeral(content string) error {
+	return ctx.respond(discordgo.InteractionResponseChannelMessageWithSource,
+		&discordgo.InteractionResponseData{Content: content, Flags: uint64(discordgo.MessageFlagsEphemeral)})
+}
+
+// RespondEmbed answers the interaction with embeds.
+func (ctx *InteractionContext) RespondEmbed(embeds ...*discordgo.MessageEmbed) error {
+	return ctx.respond(discordgo.InteractionResponseChannelMessageWithSource,
+		&discordgo.InteractionResponseData{Embeds: embeds})
+}
+
+// RespondComplex answers the interaction with full response data, such as
+// embeds with components.
+func (ctx *InteractionContext) RespondComplex(data *discordgo.InteractionResponseData) error {
+	return ctx.respond(discordgo.InteractionResponseChannelMessageWithSource, data)
+}
+
+// Defer acknowledges the interaction, showing the user that the bot is
+// thinking. Discord must be answered within three seconds, handlers that take
+// longer defer first and then use Edit or Followup.
+func (ctx *InteractionContext) Defer(ephemeral bool) error {
+	var data *discordgo.InteractionResponseData
+	if ephemeral {
+		data = &discordgo.InteractionResponseData{Flags: uint64(discordgo.MessageFlagsEphemeral)}
+	}
+	if err := ctx.respond(discordgo.InteractionResponseDeferredChannelMessageWithSource, data); err != nil {
+		return err
+	}
+	ctx.deferred = true
+	return nil
+}
+
+// Edit replaces the content of the response, or fills in a deferred one.
+func (ctx *InteractionContext) Edit(content string) (*discordgo.Message, error) {
+	return ctx.Session.InteractionResponseEdit(ctx.Core.applicationID(), ctx.Interaction, &discordgo.WebhookEdit{
+		Content: content,
+	})
+}
+
+// Followup sends another message after the interaction was responded to.
+func (ctx *InteractionContext) Followup(content string, ephemeral bool) (*discordgo.Message, error) {
+	params := &discordgo.WebhookParams{Content: content}
+	if ephemeral {
+		params.Flags = uint64(discordgo.MessageFlagsEphemeral)
+	}
+	return ctx.Session.FollowupMessageCreate(ctx.Core.applicationID(), ctx.Interaction, true, params)
+}
+
+func (ctx *InteractionContext) respond(t discordgo.InteractionResponseType, data *discordgo.InteractionResponseData) error {
+	if ctx.responded {
+		return ErrAlreadyResponded
+	}
+
+	err := ctx.Session.InteractionRespond(ctx.Interaction, &discordgo.InteractionResponse{Type: t, Data: data})
+	if err != nil {
+		return err
+	}
+	ctx.responded = true
+	return nil
+}
+
+// fail tells the user the interaction failed, unless it was already answered.
+func (ctx *InteractionContext) fail() {
+	const msg = "Something went wrong handling this interaction."
+	var err error
+	switch {
+	case ctx.deferred:
+		_, err = ctx.Edit(msg)
+	case !ctx.responded:
+		err = ctx.RespondEphemeral(msg)
+	}
+	if err != nil {
+		ctx.Core.errorlog(err)
+	}
+}
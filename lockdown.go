@@ -0,0 +1,388 @@
+package godbot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Default number of channels locked at the same time by a lockdown.
+const lockdownWorkers = 4
+
+// ErrNoChannels is returned when a lockdown finds nothing to lock.
+var ErrNoChannels = errors.New("godbot: no channels to lock")
+
+// LockdownOptions configures a guild or category lockdown.
+type LockdownOptions struct {
+	Duration        time.Duration // Unlocks everything after this long, zero until Unlock.
+	Reason          string
+	LockedBy        string       // User ID.
+	NoticeChannelID string       // Channel the summary notice is posted in, none if empty.
+	Workers         int          // Channels locked at the same time, 4 if zero.
+	Profile         *LockProfile // What is denied, Core.LockProfile if nil.
+}
+
+// LockResult is the outcome for one channel of a lockdown.
+type LockResult struct {
+	ChannelID string
+	Name      string
+	Skipped   bool // Already locked on its own, left alone.
+	Err       error
+}
+
+// Lockdown is a group of channel locks made and undone together. It is kept in
+// Core.LockStore, so it can still be undone as one after a restart.
+type Lockdown struct {
+	ID         string
+	GuildID    string
+	CategoryID string // Empty for a guild lockdown.
+	Options    LockdownOptions
+	LockedAt   time.Time
+	Expires    time.Time      // When the lockdown is undone, zero if it is not timed.
+	Results    []LockResult   // Outcome of locking each channel.
+	Locks      []*ChannelLock // Channels the lockdown locked and has yet to unlock.
+	Notice     *discordgo.Message
+
+	mu    sync.Mutex
+	bot   *Core
+	timer *time.Timer
+}
+
+// GuildLockdown locks every text, announcement, voice and stage channel of a
+// guild. Channels failing to lock are reported in Results, the others stay locked
+// until Unlock.
+func (bot *Core) GuildLockdown(gID string, opts LockdownOptions) (*Lockdown, error) {
+	return bot.lockdown(gID, "", opts)
+}
+
+// CategoryLockdown locks every lockable channel in a category.
+func (bot *Core) CategoryLockdown(categoryID string, opts LockdownOptions) (*Lockdown, error) {
+	category, err := bot.channel(categoryID)
+	if err != nil {
+		return nil, err
+	} else if category.Type != discordgo.ChannelTypeGuildCategory {
+		return nil, ErrBadChannel
+	}
+	return bot.lockdown(category.GuildID, category.ID, opts)
+}
+
+func (bot *Core) lockdown(gID, categoryID string, opts LockdownOptions) (*Lockdown, error) {
+	var channels []*discordgo.Channel
+	for _, c := range bot.Cache.GuildChannels(gID) {
+		if !lockable(c.Type) {
+			continue
+		} else if categoryID != "" && c.ParentID != categoryID {
+			continue
+		}
+		channels = append(channels, c)
+	}
+	if len(channels) == 0 {
+		return nil, ErrNoChannels
+	}
+
+	now := time.Now()
+	ld := &Lockdown{
+		ID:         fmt.Sprintf("%s-%d", gID, now.UnixNano()),
+		GuildID:    gID,
+		CategoryID: categoryID,
+		Options:    opts,
+		LockedAt:   now,
+		Results:    make([]LockResult, len(channels)),
+		bot:        bot,
+	}
+	if opts.Duration > 0 {
+		ld.Expires = now.Add(opts.Duration)
+	}
+
+	locks := make([]*ChannelLock, len(channels))
+	ld.parallel(len(channels), func(n int) {
+		c := channels[n]
+		res := &ld.Results[n]
+		res.ChannelID, res.Name = c.ID, c.Name
+
+		if bot.ActiveLock(c.ID) != nil {
+			res.Skipped = true
+			return
+		}
+
+		cl, err := bot.ChannelLockCreate(c.ID)
+		if err != nil {
+			res.Err = err
+			return
+		}
+		cl.LockedBy, cl.Reason, cl.Profile = opts.LockedBy, opts.Reason, opts.Profile
+		if opts.Duration > 0 {
+			err = cl.ChannelLockFor(opts.Duration, false)
+		} else {
+			err = cl.ChannelLock(false)
+		}
+		if err != nil {
+			res.Err = err
+			if bot.ActiveLock(c.ID) != cl {
+				return
+			}
+			// Left locked because undoing it failed, Unlock retries.
+		}
+		locks[n] = cl
+	})
+
+	for _, cl := range locks {
+		if cl != nil {
+			ld.Locks = append(ld.Locks, cl)
+		}
+	}
+
+	if opts.NoticeChannelID != "" {
+		var err error
+		ld.Notice, err = bot.Session.ChannelMessageSendEmbed(opts.NoticeChannelID, ld.noticeEmbed())
+		if err != nil {
+			bot.errorlog(fmt.Errorf("godbot: lockdown notice: %v", err))
+		}
+	}
+	if len(ld.Locks) > 0 {
+		ld.save()
+		ld.arm()
+	}
+	return ld, nil
+}
+
+// arm starts the timer of a timed lockdown.
+func (ld *Lockdown) arm() {
+	if !ld.Expires.IsZero() {
+		ld.timer = time.AfterFunc(time.Until(ld.Expires), func() { ld.Unlock() })
+	}
+}
+
+// Unlock reverses the lockdown, unlocking every channel it locked and removing
+// the notice. Channels failing to unlock are reported and kept in Locks, so
+// calling Unlock again retries them.
+func (ld *Lockdown) Unlock() []LockResult {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+
+	if ld.timer != nil {
+		ld.timer.Stop()
+	}
+
+	results := make([]LockResult, len(ld.Locks))
+	ld.parallel(len(ld.Locks), func(n int) {
+		cl := ld.Locks[n]
+		results[n] = LockResult{ChannelID: cl.Channel.ID, Name: cl.Channel.Name}
+		if err := cl.ChannelUnlock(); err != nil && err != ErrChannelNotLocked {
+			results[n].Err = err
+		}
+	})
+
+	var failed []*ChannelLock
+	for n, res := range results {
+		if res.Err != nil {
+			failed = append(failed, ld.Locks[n])
+		}
+	}
+	ld.Locks = failed
+	if len(failed) > 0 {
+		ld.save()
+		return results
+	}
+
+	if ld.Notice != nil {
+		err := ld.bot.Session.ChannelMessageDelete(ld.Notice.ChannelID, ld.Notice.ID)
+		if err != nil && !notFound(err, discordgo.ErrCodeUnknownMessage) {
+			ld.bot.errorlog(fmt.Errorf("godbot: lockdown notice: %v", err))
+		}
+		ld.Notice = nil
+	}
+	ld.forget()
+	return results
+}
+
+// record describes the lockdown for the store.
+func (ld *Lockdown) record() *LockdownRecord {
+	rec := &LockdownRecord{
+		ID:              ld.ID,
+		GuildID:         ld.GuildID,
+		CategoryID:      ld.CategoryID,
+		NoticeChannelID: ld.Options.NoticeChannelID,
+		LockedAt:        ld.LockedAt,
+		Expires:         ld.Expires,
+		LockedBy:        ld.Options.LockedBy,
+		Reason:          ld.Options.Reason,
+	}
+	for _, cl := range ld.Locks {
+		rec.ChannelIDs = append(rec.ChannelIDs, cl.Channel.ID)
+	}
+	if ld.Notice != nil {
+		rec.NoticeID = ld.Notice.ID
+	}
+	return rec
+}
+
+// save tracks the lockdown and persists its record. Failing to persist is
+// logged, the channels are locked regardless.
+func (ld *Lockdown) save() {
+	bot := ld.bot
+	bot.muLocks.Lock()
+	if bot.lockdowns == nil {
+		bot.lockdowns = make(map[string]*Lockdown)
+	}
+	bot.lockdowns[ld.ID] = ld
+	bot.muLocks.Unlock()
+
+	if err := bot.lockStore().SaveLockdown(ld.record()); err != nil {
+		bot.errorlog(fmt.Errorf("godbot: saving lockdown %s: %v", ld.ID, err))
+	}
+}
+
+// forget stops tracking the lockdown and deletes its record.
+func (ld *Lockdown) forget() {
+	bot := ld.bot
+	bot.muLocks.Lock()
+	delete(bot.lockdowns, ld.ID)
+	bot.muLocks.Unlock()
+
+	if err := bot.lockStore().DeleteLockdown(ld.ID); err != nil {
+		bot.errorlog(fmt.Errorf("godbot: deleting lockdown %s: %v", ld.ID, err))
+	}
+}
+
+// ActiveLockdowns returns the lockdowns that have yet to be undone, oldest
+// first.
+func (bot *Core) ActiveLockdowns() []*Lockdown {
+	bot.muLocks.Lock()
+	lds := make([]*Lockdown, 0, len(bot.lockdowns))
+	for _, ld := range bot.lockdowns {
+		lds = append(lds, ld)
+	}
+	bot.muLocks.Unlock()
+
+	sort.Slice(lds, func(i, j int) bool { return lds[i].LockedAt.Before(lds[j].LockedAt) })
+	return lds
+}
+
+// ActiveLockdown returns a lockdown by ID, nil if it was undone.
+func (bot *Core) ActiveLockdown(id string) *Lockdown {
+	bot.muLocks.Lock()
+	defer bot.muLocks.Unlock()
+	return bot.lockdowns[id]
+}
+
+// resumeLockdown regroups the resumed locks of a lockdown. One whose channels
+// were all unlocked meanwhile is finished off, removing its notice.
+func (bot *Core) resumeLockdown(rec *LockdownRecord) {
+	ld := &Lockdown{
+		ID:         rec.ID,
+		GuildID:    rec.GuildID,
+		CategoryID: rec.CategoryID,
+		Options: LockdownOptions{
+			Reason:          rec.Reason,
+			LockedBy:        rec.LockedBy,
+			NoticeChannelID: rec.NoticeChannelID,
+		},
+		LockedAt: rec.LockedAt,
+		Expires:  rec.Expires,
+		bot:      bot,
+	}
+	for _, chID := range rec.ChannelIDs {
+		if cl := bot.ActiveLock(chID); cl != nil {
+			ld.Locks = append(ld.Locks, cl)
+		}
+	}
+	if rec.NoticeID != "" {
+		ld.Notice = &discordgo.Message{ID: rec.NoticeID, ChannelID: rec.NoticeChannelID}
+	}
+
+	if len(ld.Locks) == 0 {
+		ld.Unlock()
+		return
+	}
+	ld.save()
+	ld.arm()
+}
+
+// Failed returns the channels that could not be locked.
+func (ld *Lockdown) Failed() []LockResult {
+	var failed []LockResult
+	for _, res := range ld.Results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// parallel calls fn for 0 through n-1 with at most Workers running at once.
+func (ld *Lockdown) parallel(n int, fn func(int)) {
+	workers := ld.Options.Workers
+	if workers <= 0 {
+		workers = lockdownWorkers
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// noticeEmbed summarizes the lockdown in one notice.
+func (ld *Lockdown) noticeEmbed() *discordgo.MessageEmbed {
+	scope := "Server"
+	if ld.CategoryID != "" {
+		scope = "Category"
+	}
+
+	var locked, skipped int
+	var failed []string
+	for _, res := range ld.Results {
+		switch {
+		case res.Err != nil:
+			failed = append(failed, fmt.Sprintf("<#%s>: %v", res.ChannelID, res.Err))
+		case res.Skipped:
+			skipped++
+		default:
+			locked++
+		}
+	}
+
+	d := fmt.Sprintf("%s is __**locked down**__, %d channels locked.", scope, locked)
+	if skipped > 0 {
+		d += fmt.Sprintf(" %d were already locked.", skipped)
+	}
+	em := &discordgo.MessageEmbed{
+		Title:       scope + " lockdown",
+		Color:       lockColor,
+		Description: d,
+	}
+	if ld.Options.Reason != "" {
+		em.Fields = append(em.Fields, &discordgo.MessageEmbedField{Name: "Reason", Value: ld.Options.Reason})
+	}
+	if !ld.Expires.IsZero() {
+		unix := ld.Expires.Unix()
+		em.Fields = append(em.Fields, &discordgo.MessageEmbedField{
+			Name:  "Unlocks",
+			Value: fmt.Sprintf("<t:%d:R> (<t:%d:t>)", unix, unix),
+		})
+	}
+	if len(failed) > 0 {
+		value := strings.Join(failed, "\n")
+		if len(value) > embedValueLimit {
+			value = value[:embedValueLimit-3] + "..."
+		}
+		em.Fields = append(em.Fields, &discordgo.MessageEmbedField{Name: "Failed", Value: value})
+	}
+	return em
+}
@@ -0,0 +1,100 @@
+package godbot
+
+import "github.com/bwmarrin/discordgo"
+
+// Stage channels, missing from discordgo.
+const channelTypeGuildStageVoice discordgo.ChannelType = 13
+
+// Permissions denied by locks whose profile leaves Deny empty.
+const (
+	// LockDenyText stops posting, reacting, attaching files and threads.
+	LockDenyText = PermissionsSend | discordgo.PermissionEmbedLinks | discordgo.PermissionAttachFiles
+
+	// LockDenyVoice stops speaking, video and the voice channel's chat.
+	LockDenyVoice = discordgo.PermissionVoiceSpeak | discordgo.PermissionVoiceStreamVideo |
+		discordgo.PermissionVoiceRequestToSpeak | discordgo.PermissionSendMessages |
+		discordgo.PermissionAddReactions
+)
+
+// LockProfile sets what a channel lock denies and who keeps it. The zero
+// value denies the default for the channel type to every role and member.
+type LockProfile struct {
+	Deny        int64    // Permissions denied, LockDenyText or LockDenyVoice if zero.
+	ExemptRoles []string // Role IDs keeping the denied permissions they had, such as moderators.
+	NoEveryone  bool     // Leaves @everyone alone when the channel has no overwrite for it.
+
+	// PreserveMembers leaves member overwrites as they are, so members allowed
+	// a denied permission by their own overwrite keep it.
+	PreserveMembers bool
+}
+
+// deny returns the permissions denied in a channel of the type.
+func (p *LockProfile) deny(t discordgo.ChannelType) int64 {
+	if p.Deny != 0 {
+		return p.Deny
+	}
+	if t == discordgo.ChannelTypeGuildVoice || t == channelTypeGuildStageVoice {
+		return LockDenyVoice
+	}
+	return LockDenyText
+}
+
+// exempt reports if the role keeps the denied permissions.
+func (p *LockProfile) exempt(rID string) bool {
+	return containsString(p.ExemptRoles, rID)
+}
+
+// lockable reports if channels of the type can be locked.
+func lockable(t discordgo.ChannelType) bool {
+	switch t {
+	case discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews,
+		discordgo.ChannelTypeGuildVoice, channelTypeGuildStageVoice:
+		return true
+	}
+	return false
+}
+
+// profile returns the lock's profile, the bot's or the zero profile.
+func (cl *ChannelLock) profile() *LockProfile {
+	if cl.Profile != nil {
+		return cl.Profile
+	} else if cl.bot != nil && cl.bot.LockProfile != nil {
+		return cl.bot.LockProfile
+	}
+	return &LockProfile{}
+}
+
+// exemptAllow returns the denied permissions an exempt role keeps: the ones
+// its members had in the channel before the lock through @everyone and the
+// role itself.
+func (cl *ChannelLock) exemptAllow(rID string, perms int64) int64 {
+	gID := cl.Channel.GuildID
+	var had int64
+	if cl.bot != nil {
+		for _, id := range []string{gID, rID} {
+			if r := cl.bot.GetRole(gID, id); r != nil {
+				had |= r.Permissions
+			}
+		}
+	}
+
+	// @everyone's overwrite applies before the role's.
+	for _, id := range []string{gID, rID} {
+		for _, ow := range cl.Overwrites {
+			if ow.ID == id && ow.Type == discordgo.PermissionOverwriteTypeRole {
+				had = had&^ow.Deny | ow.Allow
+			}
+		}
+	}
+	return perms & had
+}
+
+// hasOverwrite reports if the channel had an overwrite for the ID before the lock.
+func (cl *ChannelLock) hasOverwrite(id string) bool {
+	for _, ow := range cl.Overwrites {
+		if ow.ID == id {
+			return true
+		}
+	}
+	return false
+}
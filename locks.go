@@ -0,0 +1,207 @@
+package godbot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// lockColor is the color of lock notices.
+const lockColor = 0x800000
+
+// Backoff between attempts to unlock an expired lock that failed to unlock.
+const (
+	unlockRetryMin = 5 * time.Second
+	unlockRetryMax = 10 * time.Minute
+)
+
+// ChannelLockFor locks the channel and unlocks it once d has passed. The lock
+// notice shows when that will be. Locking an already locked channel sets its
+// new expiry.
+func (cl *ChannelLock) ChannelLockFor(d time.Duration, alert bool) error {
+	if cl == nil {
+		return ErrNilChannelLock
+	} else if d <= 0 {
+		return ErrBadDuration
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	wasLocked := cl.Locked
+	cl.Expires = time.Now().Add(d)
+	if err := cl.lock(alert); err != nil {
+		cl.Expires = time.Time{}
+		return err
+	}
+
+	cl.arm()
+	cl.save()
+	if wasLocked {
+		return cl.updateNotice()
+	}
+	return nil
+}
+
+// Extend pushes back when a locked channel unlocks by d. A lock without an
+// expiry gets one d from now.
+func (cl *ChannelLock) Extend(d time.Duration) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if !cl.Locked {
+		return ErrChannelNotLocked
+	}
+
+	if cl.Expires.IsZero() {
+		cl.Expires = time.Now()
+	}
+	cl.Expires = cl.Expires.Add(d)
+	cl.arm()
+	cl.save()
+	return cl.updateNotice()
+}
+
+// StopTimer cancels the automatic unlock, the channel stays locked until
+// ChannelUnlock is called.
+func (cl *ChannelLock) StopTimer() error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if !cl.Locked {
+		return ErrChannelNotLocked
+	}
+	cl.stopTimer()
+	cl.save()
+	return cl.updateNotice()
+}
+
+// Remaining returns how long until the channel unlocks, zero when it is not a
+// timed lock.
+func (cl *ChannelLock) Remaining() time.Duration {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if !cl.Locked || cl.Expires.IsZero() {
+		return 0
+	}
+	return time.Until(cl.Expires)
+}
+
+// arm starts or resets the unlock timer, the mutex must be held.
+func (cl *ChannelLock) arm() {
+	if cl.timer != nil {
+		cl.timer.Stop()
+	}
+	cl.retry = 0
+	cl.timer = time.AfterFunc(time.Until(cl.Expires), cl.expire)
+}
+
+// stopTimer stops the unlock timer and clears the expiry, the mutex must be held.
+func (cl *ChannelLock) stopTimer() {
+	if cl.timer != nil {
+		cl.timer.Stop()
+		cl.timer = nil
+	}
+	cl.Expires = time.Time{}
+}
+
+// expire unlocks the channel when a timed lock runs out.
+func (cl *ChannelLock) expire() {
+	cl.mu.Lock()
+	stale := cl.Expires.IsZero() || time.Now().Before(cl.Expires)
+	cl.mu.Unlock()
+	if stale {
+		// Stopped, extended or locked again without a timer after it fired.
+		return
+	}
+
+	err := cl.ChannelUnlock()
+	if err == nil || err == ErrChannelNotLocked {
+		return
+	}
+	if cl.bot != nil {
+		cl.bot.errorlog(fmt.Errorf("godbot: unlocking %s: %v", cl.Channel.ID, err))
+	}
+	if _, ok := err.(*LockError); ok {
+		cl.retryExpire()
+	}
+}
+
+// retryExpire tries the unlock again later, backing off on each failure.
+func (cl *ChannelLock) retryExpire() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if !cl.Locked || cl.Expires.IsZero() || time.Now().Before(cl.Expires) {
+		// Unlocked, timer stopped or extended in the meantime.
+		return
+	}
+
+	cl.retry *= 2
+	if cl.retry < unlockRetryMin {
+		cl.retry = unlockRetryMin
+	} else if cl.retry > unlockRetryMax {
+		cl.retry = unlockRetryMax
+	}
+	cl.timer = time.AfterFunc(cl.retry, cl.expire)
+}
+
+// noticeEmbed builds the lock notice, timed locks show a live countdown.
+func (cl *ChannelLock) noticeEmbed() *discordgo.MessageEmbed {
+	d := fmt.Sprintf("**%s** channel is temporarily __**locked**__ for maintenance.\n%4s message will disappear when it is available.", cl.Channel.Name, "This")
+
+	em := &discordgo.MessageEmbed{
+		Author:      &discordgo.MessageEmbedAuthor{},
+		Color:       lockColor,
+		Description: d,
+		Fields:      []*discordgo.MessageEmbedField{},
+	}
+	if !cl.Expires.IsZero() {
+		unix := cl.Expires.Unix()
+		em.Fields = append(em.Fields, &discordgo.MessageEmbedField{
+			Name:  "Unlocks",
+			Value: fmt.Sprintf("<t:%d:R> (<t:%d:t>)", unix, unix),
+		})
+		em.Footer = &discordgo.MessageEmbedFooter{Text: "Unlocks at"}
+		em.Timestamp = cl.Expires.Format(time.RFC3339)
+	}
+	return em
+}
+
+// noticeComponents returns the Unlock button when it is enabled.
+func (cl *ChannelLock) noticeComponents() []discordgo.MessageComponent {
+	if !cl.UnlockButton || cl.bot == nil {
+		return nil
+	}
+	return []discordgo.MessageComponent{discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{discordgo.Button{
+			Label:    "Unlock",
+			Style:    discordgo.DangerButton,
+			CustomID: unlockButtonID,
+		}},
+	}}
+}
+
+// updateNotice edits the lock notice after the expiry changed, the mutex must
+// be held.
+func (cl *ChannelLock) updateNotice() error {
+	if cl.Message == nil {
+		return nil
+	}
+
+	edit := discordgo.NewMessageEdit(cl.Channel.ID, cl.Message.ID)
+	edit.Embeds = []*discordgo.MessageEmbed{cl.noticeEmbed()}
+	edit.Components = cl.noticeComponents()
+	if edit.Components == nil {
+		edit.Components = []discordgo.MessageComponent{}
+	}
+
+	msg, err := cl.Session.ChannelMessageEditComplex(edit)
+	if err != nil {
+		return err
+	}
+	cl.Message = msg
+	return nil
+}
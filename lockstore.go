@@ -0,0 +1,489 @@
+package godbot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// LockRecord is what is kept of a channel lock to restore the channel after a
+// restart.
+type LockRecord struct {
+	ChannelID    string                           `json:"channel_id"`
+	GuildID      string                           `json:"guild_id"`
+	Overwrites   []*discordgo.PermissionOverwrite `json:"overwrites"` // Before the lock.
+	Created      []string                         `json:"created,omitempty"`
+	MessageID    string                           `json:"message_id,omitempty"`
+	UnlockButton bool                             `json:"unlock_button,omitempty"`
+	LockedAt     time.Time                        `json:"locked_at"`
+	Expires      time.Time                        `json:"expires,omitempty"`
+	LockedBy     string                           `json:"locked_by,omitempty"` // User ID.
+	Reason       string                           `json:"reason,omitempty"`
+}
+
+// LockdownRecord is what is kept of a lockdown to undo it as one after a
+// restart. The channels' own records hold their overwrites.
+type LockdownRecord struct {
+	ID              string    `json:"id"`
+	GuildID         string    `json:"guild_id"`
+	CategoryID      string    `json:"category_id,omitempty"`
+	ChannelIDs      []string  `json:"channel_ids"` // Channels still locked by the lockdown.
+	NoticeChannelID string    `json:"notice_channel_id,omitempty"`
+	NoticeID        string    `json:"notice_id,omitempty"`
+	LockedAt        time.Time `json:"locked_at"`
+	Expires         time.Time `json:"expires,omitempty"`
+	LockedBy        string    `json:"locked_by,omitempty"` // User ID.
+	Reason          string    `json:"reason,omitempty"`
+}
+
+// LockStore persists lock and lockdown records. Core.LockStore is in memory
+// by default, FileLockStore keeps them across restarts.
+type LockStore interface {
+	SaveLock(rec *LockRecord) error
+	DeleteLock(chID string) error
+	Locks() ([]*LockRecord, error)
+
+	SaveLockdown(rec *LockdownRecord) error
+	DeleteLockdown(id string) error
+	Lockdowns() ([]*LockdownRecord, error)
+}
+
+// MemoryLockStore keeps lock records in memory.
+type MemoryLockStore struct {
+	mu        sync.Mutex
+	locks     map[string]*LockRecord     // [channel ID] record
+	lockdowns map[string]*LockdownRecord // [lockdown ID] record
+}
+
+// NewMemoryLockStore creates an empty in-memory store.
+func NewMemoryLockStore() *MemoryLockStore {
+	return &MemoryLockStore{
+		locks:     make(map[string]*LockRecord),
+		lockdowns: make(map[string]*LockdownRecord),
+	}
+}
+
+// SaveLock adds or replaces the record of a channel.
+func (ms *MemoryLockStore) SaveLock(rec *LockRecord) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.locks == nil {
+		ms.locks = make(map[string]*LockRecord)
+	}
+	ms.locks[rec.ChannelID] = rec
+	return nil
+}
+
+// DeleteLock removes the record of a channel.
+func (ms *MemoryLockStore) DeleteLock(chID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.locks, chID)
+	return nil
+}
+
+// Locks returns every record, oldest lock first.
+func (ms *MemoryLockStore) Locks() ([]*LockRecord, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	recs := make([]*LockRecord, 0, len(ms.locks))
+	for _, rec := range ms.locks {
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].LockedAt.Before(recs[j].LockedAt) })
+	return recs, nil
+}
+
+// SaveLockdown adds or replaces the record of a lockdown.
+func (ms *MemoryLockStore) SaveLockdown(rec *LockdownRecord) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.lockdowns == nil {
+		ms.lockdowns = make(map[string]*LockdownRecord)
+	}
+	ms.lockdowns[rec.ID] = rec
+	return nil
+}
+
+// DeleteLockdown removes the record of a lockdown.
+func (ms *MemoryLockStore) DeleteLockdown(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.lockdowns, id)
+	return nil
+}
+
+// Lockdowns returns every lockdown record, oldest first.
+func (ms *MemoryLockStore) Lockdowns() ([]*LockdownRecord, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	recs := make([]*LockdownRecord, 0, len(ms.lockdowns))
+	for _, rec := range ms.lockdowns {
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].LockedAt.Before(recs[j].LockedAt) })
+	return recs, nil
+}
+
+// lockFile is the layout of a FileLockStore's file.
+type lockFile struct {
+	Locks     []*LockRecord     `json:"locks"`
+	Lockdowns []*LockdownRecord `json:"lockdowns,omitempty"`
+}
+
+// FileLockStore keeps lock records in a JSON file, rewritten on every change.
+type FileLockStore struct {
+	MemoryLockStore
+	path    string
+	muWrite sync.Mutex // Serializes writes so an older snapshot never replaces a newer one.
+}
+
+// NewFileLockStore loads the records in the file at path, a missing file is
+// an empty store.
+func NewFileLockStore(path string) (*FileLockStore, error) {
+	fs := &FileLockStore{path: path}
+	fs.locks = make(map[string]*LockRecord)
+	fs.lockdowns = make(map[string]*LockdownRecord)
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fs, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var file lockFile
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		// Files written before lockdowns were kept only list locks.
+		err = json.Unmarshal(data, &file.Locks)
+	} else {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("godbot: reading locks from %s: %v", path, err)
+	}
+	for _, rec := range file.Locks {
+		fs.locks[rec.ChannelID] = rec
+	}
+	for _, rec := range file.Lockdowns {
+		fs.lockdowns[rec.ID] = rec
+	}
+	return fs, nil
+}
+
+// SaveLock adds or replaces the record of a channel and writes the file.
+func (fs *FileLockStore) SaveLock(rec *LockRecord) error {
+	if err := fs.MemoryLockStore.SaveLock(rec); err != nil {
+		return err
+	}
+	return fs.write()
+}
+
+// DeleteLock removes the record of a channel and writes the file.
+func (fs *FileLockStore) DeleteLock(chID string) error {
+	if err := fs.MemoryLockStore.DeleteLock(chID); err != nil {
+		return err
+	}
+	return fs.write()
+}
+
+// SaveLockdown adds or replaces the record of a lockdown and writes the file.
+func (fs *FileLockStore) SaveLockdown(rec *LockdownRecord) error {
+	if err := fs.MemoryLockStore.SaveLockdown(rec); err != nil {
+		return err
+	}
+	return fs.write()
+}
+
+// DeleteLockdown removes the record of a lockdown and writes the file.
+func (fs *FileLockStore) DeleteLockdown(id string) error {
+	if err := fs.MemoryLockStore.DeleteLockdown(id); err != nil {
+		return err
+	}
+	return fs.write()
+}
+
+// write replaces the file, through a temporary file so it is never partial.
+func (fs *FileLockStore) write() error {
+	fs.muWrite.Lock()
+	defer fs.muWrite.Unlock()
+
+	var file lockFile
+	file.Locks, _ = fs.Locks()
+	file.Lockdowns, _ = fs.Lockdowns()
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(fs.path), ".locks-*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.path)
+}
+
+// lockStore returns the bot's store, creating the default.
+func (bot *Core) lockStore() LockStore {
+	bot.muLocks.Lock()
+	defer bot.muLocks.Unlock()
+	if bot.LockStore == nil {
+		bot.LockStore = NewMemoryLockStore()
+	}
+	return bot.LockStore
+}
+
+// record describes the lock for the store, the mutex must be held.
+func (cl *ChannelLock) record() *LockRecord {
+	rec := &LockRecord{
+		ChannelID:    cl.Channel.ID,
+		GuildID:      cl.Channel.GuildID,
+		Created:      append([]string(nil), cl.Created...),
+		UnlockButton: cl.UnlockButton,
+		LockedAt:     cl.LockedAt,
+		Expires:      cl.Expires,
+		LockedBy:     cl.LockedBy,
+		Reason:       cl.Reason,
+	}
+	for _, ow := range cl.Overwrites {
+		o := *ow
+		rec.Overwrites = append(rec.Overwrites, &o)
+	}
+	if cl.Message != nil {
+		rec.MessageID = cl.Message.ID
+	}
+	return rec
+}
+
+// save tracks the locked channel and persists its record, the mutex must be
+// held. Failing to persist is logged, the lock itself is in place.
+func (cl *ChannelLock) save() {
+	bot := cl.bot
+	if bot == nil {
+		return
+	}
+
+	bot.muLocks.Lock()
+	if bot.locks == nil {
+		bot.locks = make(map[string]*ChannelLock)
+	}
+	bot.locks[cl.Channel.ID] = cl
+	bot.muLocks.Unlock()
+
+	if err := bot.lockStore().SaveLock(cl.record()); err != nil {
+		bot.errorlog(fmt.Errorf("godbot: saving lock of %s: %v", cl.Channel.ID, err))
+	}
+}
+
+// forget stops tracking the channel and deletes its record.
+func (cl *ChannelLock) forget() {
+	bot := cl.bot
+	if bot == nil {
+		return
+	}
+
+	bot.muLocks.Lock()
+	if bot.locks[cl.Channel.ID] == cl {
+		delete(bot.locks, cl.Channel.ID)
+	}
+	bot.muLocks.Unlock()
+
+	if err := bot.lockStore().DeleteLock(cl.Channel.ID); err != nil {
+		bot.errorlog(fmt.Errorf("godbot: deleting lock of %s: %v", cl.Channel.ID, err))
+	}
+}
+
+// ActiveLocks returns the locked channels, oldest lock first.
+func (bot *Core) ActiveLocks() []*ChannelLock {
+	bot.muLocks.Lock()
+	locks := make([]*ChannelLock, 0, len(bot.locks))
+	for _, cl := range bot.locks {
+		locks = append(locks, cl)
+	}
+	bot.muLocks.Unlock()
+
+	sort.Slice(locks, func(i, j int) bool { return locks[i].LockedAt.Before(locks[j].LockedAt) })
+	return locks
+}
+
+// ActiveLock returns the lock of a channel, nil if it is not locked.
+func (bot *Core) ActiveLock(chID string) *ChannelLock {
+	bot.muLocks.Lock()
+	defer bot.muLocks.Unlock()
+	return bot.locks[chID]
+}
+
+// ResumeLocks restores the locks in the LockStore after a restart. Timed
+// locks that expired while the bot was down are unlocked, the others have
+// their timer and Unlock button re-armed. Lockdowns are regrouped afterwards,
+// see ActiveLockdowns. It runs on Start, failures are logged and the remaining
+// locks still resumed.
+func (bot *Core) ResumeLocks() error {
+	recs, err := bot.lockStore().Locks()
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range recs {
+		if bot.ActiveLock(rec.ChannelID) != nil {
+			continue
+		}
+		if err := bot.resumeLock(rec); err != nil {
+			bot.errorlog(fmt.Errorf("godbot: resuming lock of %s: %v", rec.ChannelID, err))
+		}
+	}
+
+	lockdowns, err := bot.lockStore().Lockdowns()
+	if err != nil {
+		return err
+	}
+	for _, rec := range lockdowns {
+		if bot.ActiveLockdown(rec.ID) == nil {
+			bot.resumeLockdown(rec)
+		}
+	}
+	return nil
+}
+
+func (bot *Core) resumeLock(rec *LockRecord) error {
+	channel, err := bot.channel(rec.ChannelID)
+	if err != nil {
+		// The record is the only copy of the original overwrites, it is only
+		// dropped once discord says the channel is gone.
+		if notFound(err, discordgo.ErrCodeUnknownChannel) {
+			bot.lockStore().DeleteLock(rec.ChannelID)
+		}
+		return err
+	}
+
+	cl := &ChannelLock{
+		Locked:       true,
+		UnlockButton: rec.UnlockButton,
+		Session:      bot.Session,
+		Channel:      &Channel{Channel: channel},
+		Guild:        bot.GetGuild(rec.GuildID),
+		Overwrites:   rec.Overwrites,
+		Created:      rec.Created,
+		LockedAt:     rec.LockedAt,
+		LockedBy:     rec.LockedBy,
+		Reason:       rec.Reason,
+		Expires:      rec.Expires,
+		bot:          bot,
+	}
+	for _, ow := range rec.Overwrites {
+		if r := bot.GetRole(rec.GuildID, ow.ID); r != nil {
+			cl.Roles = append(cl.Roles, r)
+		}
+	}
+	if rec.MessageID != "" {
+		cl.Message = &discordgo.Message{ID: rec.MessageID, ChannelID: rec.ChannelID}
+	}
+
+	cl.mu.Lock()
+	cl.save()
+	if !cl.Expires.IsZero() {
+		cl.arm()
+	}
+	cl.mu.Unlock()
+
+	if cl.Message != nil && cl.noticeComponents() != nil {
+		return bot.AddComponent(&Component{
+			CustomID:    unlockButtonID,
+			MessageID:   cl.Message.ID,
+			Permissions: discordgo.PermissionManageChannels,
+			Handler:     cl.unlockPressed,
+		})
+	}
+	return nil
+}
+
+// notFound reports if err is discord saying what was asked for does not
+// exist, by its error code or a 404.
+func notFound(err error, code int) bool {
+	rerr, ok := err.(*discordgo.RESTError)
+	if !ok {
+		return false
+	} else if rerr.Message != nil && rerr.Message.Code == code {
+		return true
+	}
+	return rerr.Response != nil && rerr.Response.StatusCode == http.StatusNotFound
+}
+
+// LocksCommand creates a command listing the locked channels of the guild it
+// is used in. Register it with a Router like any other command.
+func (bot *Core) LocksCommand() *Command {
+	return &Command{
+		Name:        "locks",
+		Help:        "Lists the locked channels.",
+		Category:    "Moderation",
+		Permissions: discordgo.PermissionManageChannels,
+		Handler: func(ctx *Context) error {
+			var lines []string
+			for _, cl := range bot.ActiveLocks() {
+				if ctx.Guild == nil || cl.Channel.GuildID != ctx.Guild.ID {
+					continue
+				}
+				lines = append(lines, cl.summary())
+			}
+
+			em := &discordgo.MessageEmbed{Title: "Locked channels", Color: lockColor}
+			if len(lines) == 0 {
+				em.Description = "No channels are locked."
+			} else {
+				em.Description = joinLines(lines, embedDescriptionLimit)
+			}
+			_, err := ctx.Session.ChannelMessageSendEmbed(ctx.Message.ChannelID, em)
+			return err
+		},
+	}
+}
+
+// joinLines joins as many whole lines as fit in limit bytes, noting how many
+// were left out.
+func joinLines(lines []string, limit int) string {
+	text := strings.Join(lines, "\n")
+	for n := len(lines) - 1; len(text) > limit && n > 0; n-- {
+		text = strings.Join(lines[:n], "\n") + fmt.Sprintf("\n...and %d more.", len(lines)-n)
+	}
+	return text
+}
+
+// summary describes the lock on one line.
+func (cl *ChannelLock) summary() string {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	line := fmt.Sprintf("<#%s> locked <t:%d:R>", cl.Channel.ID, cl.LockedAt.Unix())
+	if cl.LockedBy != "" {
+		line += fmt.Sprintf(" by <@%s>", cl.LockedBy)
+	}
+	if !cl.Expires.IsZero() {
+		line += fmt.Sprintf(", unlocks <t:%d:R>", cl.Expires.Unix())
+	}
+	if cl.Reason != "" {
+		line += ": " + cl.Reason
+	}
+	return line
+}
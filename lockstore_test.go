@@ -0,0 +1,74 @@
+package godbot
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileLockStoreConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks.json")
+	fs, err := NewFileLockStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every even channel is saved, every odd one saved then deleted.
+	var wg sync.WaitGroup
+	for n := 0; n < 200; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			chID := fmt.Sprint(n)
+			if err := fs.SaveLock(&LockRecord{ChannelID: chID, LockedAt: time.Unix(int64(n), 0)}); err != nil {
+				t.Error(err)
+			}
+			if n%2 == 1 {
+				if err := fs.DeleteLock(chID); err != nil {
+					t.Error(err)
+				}
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	loaded, err := NewFileLockStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, _ := loaded.Locks()
+	if len(recs) != 100 {
+		t.Fatalf("file has %d records, want 100", len(recs))
+	}
+	for _, rec := range recs {
+		var n int
+		fmt.Sscan(rec.ChannelID, &n)
+		if n%2 == 1 {
+			t.Errorf("deleted record %s is in the file", rec.ChannelID)
+		}
+	}
+}
+
+func TestJoinLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		limit int
+		want  string
+	}{
+		{"everything fits", []string{"ab", "cd"}, 5, "ab\ncd"},
+		{"whole lines are dropped", []string{"aaaaaaaaaa", "bbbbbbbbbb", "cccccccccc", "dddddddddd"}, 40, "aaaaaaaaaa\nbbbbbbbbbb\n...and 2 more."},
+		{"multibyte runes are kept whole", []string{"éééééééééé", "éééééééééé", "éééééééééé"}, 40, "éééééééééé\n...and 2 more."},
+		{"the first line is always kept", []string{"abcdef", "gh"}, 4, "abcdef\n...and 1 more."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := joinLines(tt.lines, tt.limit); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
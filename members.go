@@ -0,0 +1,273 @@
+package godbot
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Page size used when querying members over REST.
+const memberPageSize = 1000
+
+// GetMember gets a member of a guild, querying discord if it is not cached.
+func (bot *Core) GetMember(gID, uID string) (*discordgo.Member, error) {
+	return bot.member(gID, uID)
+}
+
+// MembersLoaded checks if every member of the guild has been received from
+// discord since the guild became available.
+func (bot *Core) MembersLoaded(gID string) bool {
+	bot.muMembers.Lock()
+	defer bot.muMembers.Unlock()
+	return bot.membersLoaded[gID]
+}
+
+// MemberByTag finds a member of a guild from a Username#Discriminator.
+func (bot *Core) MemberByTag(gID, tag string) (*discordgo.Member, error) {
+	name, discrim, err := splitTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	return bot.memberByTag(gID, name, discrim, nil)
+}
+
+// memberByTag searches the cache, then discord while the guild's members are
+// still loading. A budget caps the members fetched from discord and is spent
+// by them, nil is unlimited.
+func (bot *Core) memberByTag(gID, name, discrim string, budget *int) (*discordgo.Member, error) {
+	if m := bot.cachedMemberByTag(gID, name, discrim); m != nil {
+		return m, nil
+	}
+
+	if bot.MembersLoaded(gID) || (budget != nil && *budget <= 0) {
+		return nil, ErrNotFound
+	}
+
+	// The cache is still being filled, search discord directly.
+	var found *discordgo.Member
+	err := bot.pageMembers(gID, func(m *discordgo.Member) bool {
+		if m.User.Username == name && m.User.Discriminator == discrim {
+			found = m
+			return false
+		}
+		if budget != nil {
+			*budget--
+			return *budget > 0
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	} else if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+// memberByTagAnyGuild looks a tag up in the guild first, then in every other
+// guild, the way UserID does.
+func (bot *Core) memberByTagAnyGuild(tag, first string, budget *int) (*discordgo.Member, error) {
+	name, discrim, err := splitTag(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	var gIDs []string
+	if first != "" {
+		gIDs = append(gIDs, first)
+	}
+	for _, g := range bot.Guilds() {
+		if g.ID != first {
+			gIDs = append(gIDs, g.ID)
+		}
+	}
+
+	for _, gID := range gIDs {
+		m, err := bot.memberByTag(gID, name, discrim, budget)
+		if err != ErrNotFound {
+			return m, err
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// cachedMemberByTag finds a member by username and discriminator in the cache
+// only, nil if it is not there.
+func (bot *Core) cachedMemberByTag(gID, name, discrim string) *discordgo.Member {
+	for _, m := range bot.Cache.Members(gID) {
+		if m.User.Username == name && m.User.Discriminator == discrim {
+			return m
+		}
+	}
+	return nil
+}
+
+// MembersByNickname returns the members of a guild with the nickname, ignoring
+// case. Members without a nickname are matched by username.
+func (bot *Core) MembersByNickname(gID, nick string) (members []*discordgo.Member) {
+	for _, m := range bot.Cache.Members(gID) {
+		if strings.EqualFold(displayName(m), nick) {
+			members = append(members, m)
+		}
+	}
+	return
+}
+
+// SearchMembers finds members of a guild whose username or nickname matches
+// the query, ignoring case. Exact matches come first, followed by prefix,
+// substring and finally fuzzy matches where the query's letters appear in
+// order. A limit of zero returns every match.
+func (bot *Core) SearchMembers(gID, query string, limit int) []*discordgo.Member {
+	type match struct {
+		member *discordgo.Member
+		rank   int
+	}
+
+	query = strings.ToLower(query)
+	var matches []match
+	for _, m := range bot.Cache.Members(gID) {
+		rank := matchRank(strings.ToLower(m.User.Username), query)
+		if m.Nick != "" {
+			if r := matchRank(strings.ToLower(m.Nick), query); r < rank {
+				rank = r
+			}
+		}
+		if rank < rankNone {
+			matches = append(matches, match{member: m, rank: rank})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return strings.ToLower(displayName(matches[i].member)) < strings.ToLower(displayName(matches[j].member))
+	})
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	members := make([]*discordgo.Member, len(matches))
+	for n, m := range matches {
+		members[n] = m.member
+	}
+	return members
+}
+
+// MembersWithRole returns the members of a guild that have the role.
+func (bot *Core) MembersWithRole(gID, rID string) (members []*discordgo.Member) {
+	for _, m := range bot.Cache.Members(gID) {
+		if hasRole(m, rID) {
+			members = append(members, m)
+		}
+	}
+	return
+}
+
+// pageMembers walks every member of a guild over REST, caching them as it
+// goes, until fn returns false.
+func (bot *Core) pageMembers(gID string, fn func(*discordgo.Member) bool) error {
+	var after string
+	for {
+		members, err := bot.Session.GuildMembers(gID, after, memberPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range members {
+			after = m.User.ID
+			bot.Cache.SetMember(gID, m)
+			if !fn(m) {
+				return nil
+			}
+		}
+
+		if len(members) < memberPageSize {
+			return nil
+		}
+	}
+}
+
+// requestMembers asks the gateway for every member of a guild, they arrive as
+// GuildMembersChunk events.
+func (bot *Core) requestMembers(gID string) {
+	bot.muMembers.Lock()
+	if bot.membersLoaded == nil {
+		bot.membersLoaded = make(map[string]bool)
+	}
+	bot.membersLoaded[gID] = false
+	bot.muMembers.Unlock()
+
+	err := bot.Session.RequestGuildMembers(gID, "", 0, false)
+	if err != nil {
+		bot.errorlog(err)
+	}
+}
+
+// Ranks used by SearchMembers, lower is better.
+const (
+	rankExact = iota
+	rankPrefix
+	rankContains
+	rankFuzzy
+	rankNone
+)
+
+func matchRank(name, query string) int {
+	switch {
+	case name == query:
+		return rankExact
+	case strings.HasPrefix(name, query):
+		return rankPrefix
+	case strings.Contains(name, query):
+		return rankContains
+	case isSubsequence(name, query):
+		return rankFuzzy
+	}
+	return rankNone
+}
+
+// isSubsequence checks if every rune of query appears in name, in order.
+func isSubsequence(name, query string) bool {
+	q := []rune(query)
+	if len(q) == 0 {
+		return true
+	}
+	for _, r := range name {
+		if r == q[0] {
+			q = q[1:]
+			if len(q) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// displayName is the nickname of a member, or the username without one.
+func displayName(m *discordgo.Member) string {
+	if m.Nick != "" {
+		return m.Nick
+	}
+	return m.User.Username
+}
+
+func hasRole(m *discordgo.Member, rID string) bool {
+	for _, r := range m.Roles {
+		if r == rID {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTag splits a Username#Discriminator.
+func splitTag(tag string) (name, discrim string, err error) {
+	n := strings.LastIndex(tag, "#")
+	if n < 1 || n == len(tag)-1 {
+		return "", "", ErrBadTag
+	}
+	return tag[:n], tag[n+1:], nil
+}
@@ -0,0 +1,244 @@
+package godbot
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Dispatch is an event, or a command invocation, passing through middleware.
+type Dispatch struct {
+	Core      *Core
+	Session   *discordgo.Session
+	Event     interface{}
+	Context   *Context // Set when a command is being dispatched.
+	GuildID   string
+	ChannelID string
+	UserID    string          // User that caused the event, if known.
+	Author    *discordgo.User // Set when the full user is part of the event.
+}
+
+// Name is the command name or the event's type name.
+func (d *Dispatch) Name() string {
+	if d.Context != nil {
+		return d.Context.Command.Name
+	}
+	return eventName(reflect.TypeOf(d.Event))
+}
+
+// DispatchFunc handles a dispatch.
+type DispatchFunc func(*Dispatch) error
+
+// Middleware wraps dispatching. It calls next to continue, or returns without
+// calling it to stop the event or command from being handled.
+type Middleware func(next DispatchFunc) DispatchFunc
+
+// Use adds middleware around the delivery of every event to handlers,
+// including the ones the command router and interactions handle. The first
+// middleware added runs first. The bot's own caches are updated regardless.
+func (bot *Core) Use(mw ...Middleware) {
+	bot.muRouter.Lock()
+	defer bot.muRouter.Unlock()
+	bot.middleware = append(bot.middleware, mw...)
+}
+
+// Use adds middleware around every command the router dispatches. It runs
+// after the bot's event middleware and before the command's own.
+func (r *Router) Use(mw ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, mw...)
+}
+
+// chain wraps final in the middleware, the first one is the outermost.
+func chain(final DispatchFunc, mws ...[]Middleware) DispatchFunc {
+	h := final
+	for n := len(mws) - 1; n >= 0; n-- {
+		for i := len(mws[n]) - 1; i >= 0; i-- {
+			h = mws[n][i](h)
+		}
+	}
+	return h
+}
+
+// publishEvent passes the event through the bot's middleware to its handlers.
+func (bot *Core) publishEvent(s *discordgo.Session, event interface{}) {
+	bot.muRouter.Lock()
+	mws := bot.middleware
+	bot.muRouter.Unlock()
+
+	if len(mws) == 0 {
+		bot.publish(s, event)
+		return
+	}
+
+	d := newDispatch(bot, s, event)
+	h := chain(func(d *Dispatch) error {
+		bot.publish(d.Session, d.Event)
+		return nil
+	}, mws)
+	if err := h(d); err != nil {
+		bot.errorlog(fmt.Errorf("godbot: %s middleware: %v", d.Name(), err))
+	}
+}
+
+// newDispatch fills in where an event came from and who caused it.
+func newDispatch(bot *Core, s *discordgo.Session, event interface{}) *Dispatch {
+	d := &Dispatch{Core: bot, Session: s, Event: event}
+	switch e := event.(type) {
+	case *discordgo.MessageCreate:
+		d.GuildID, d.ChannelID, d.Author = e.GuildID, e.ChannelID, e.Author
+	case *discordgo.MessageUpdate:
+		d.GuildID, d.ChannelID, d.Author = e.GuildID, e.ChannelID, e.Author
+	case *discordgo.MessageDelete:
+		d.GuildID, d.ChannelID = e.GuildID, e.ChannelID
+	case *discordgo.MessageReactionAdd:
+		d.GuildID, d.ChannelID, d.UserID = e.GuildID, e.ChannelID, e.UserID
+		if e.Member != nil {
+			d.Author = e.Member.User
+		}
+	case *discordgo.MessageReactionRemove:
+		d.GuildID, d.ChannelID, d.UserID = e.GuildID, e.ChannelID, e.UserID
+	case *discordgo.TypingStart:
+		d.GuildID, d.ChannelID, d.UserID = e.GuildID, e.ChannelID, e.UserID
+	case *discordgo.InteractionCreate:
+		d.GuildID, d.ChannelID = e.GuildID, e.ChannelID
+		if e.Member != nil {
+			d.Author = e.Member.User
+		} else {
+			d.Author = e.User
+		}
+	case *discordgo.GuildMemberAdd:
+		d.GuildID, d.Author = e.GuildID, e.User
+	case *discordgo.GuildMemberUpdate:
+		d.GuildID, d.Author = e.GuildID, e.User
+	case *discordgo.GuildMemberRemove:
+		d.GuildID, d.Author = e.GuildID, e.User
+	case *discordgo.VoiceStateUpdate:
+		d.GuildID, d.ChannelID, d.UserID = e.GuildID, e.ChannelID, e.UserID
+	}
+	if d.Author != nil {
+		d.UserID = d.Author.ID
+	}
+	return d
+}
+
+// commandDispatch describes a command invocation for middleware.
+func commandDispatch(ctx *Context) *Dispatch {
+	d := newDispatch(ctx.Core, ctx.Session, &discordgo.MessageCreate{Message: ctx.Message})
+	d.Context = ctx
+	return d
+}
+
+// Recover turns a panic further down the chain into an error.
+func Recover() Middleware {
+	return func(next DispatchFunc) DispatchFunc {
+		return func(d *Dispatch) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic: %v", r)
+				}
+			}()
+			return next(d)
+		}
+	}
+}
+
+// Logger logs every dispatch with its duration and error.
+func Logger(l *log.Logger) Middleware {
+	return Timing(func(d *Dispatch, took time.Duration, err error) {
+		if err != nil {
+			l.Printf("%s guild=%s channel=%s user=%s took=%s err=%v", d.Name(), d.GuildID, d.ChannelID, d.UserID, took, err)
+		} else {
+			l.Printf("%s guild=%s channel=%s user=%s took=%s", d.Name(), d.GuildID, d.ChannelID, d.UserID, took)
+		}
+	})
+}
+
+// Timing reports how long every dispatch took.
+func Timing(report func(d *Dispatch, took time.Duration, err error)) Middleware {
+	return func(next DispatchFunc) DispatchFunc {
+		return func(d *Dispatch) error {
+			start := time.Now()
+			err := next(d)
+			report(d, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// IgnoreBots stops events and commands caused by bots.
+func IgnoreBots() Middleware {
+	return Filter(func(d *Dispatch) bool {
+		return d.Author == nil || !d.Author.Bot
+	})
+}
+
+// IgnoreSelf stops events and commands caused by the bot itself.
+func IgnoreSelf() Middleware {
+	return Filter(func(d *Dispatch) bool {
+		return d.UserID == "" || d.Core.User == nil || d.UserID != d.Core.User.ID
+	})
+}
+
+// AllowGuilds only lets through events and commands from the guilds. Ones not
+// tied to a guild are let through.
+func AllowGuilds(gIDs ...string) Middleware {
+	allowed := stringSet(gIDs)
+	return Filter(func(d *Dispatch) bool {
+		return d.GuildID == "" || allowed[d.GuildID]
+	})
+}
+
+// AllowChannels only lets through events and commands from the channels. Ones
+// not tied to a channel are let through.
+func AllowChannels(chIDs ...string) Middleware {
+	allowed := stringSet(chIDs)
+	return Filter(func(d *Dispatch) bool {
+		return d.ChannelID == "" || allowed[d.ChannelID]
+	})
+}
+
+// RequirePermissions only lets through users with the permissions in the
+// channel. Commands reply with what is missing, events are dropped.
+func RequirePermissions(perms int64) Middleware {
+	return func(next DispatchFunc) DispatchFunc {
+		return func(d *Dispatch) error {
+			if d.GuildID != "" && d.ChannelID != "" && d.UserID != "" {
+				ok, err := d.Core.HasPermissions(d.ChannelID, d.UserID, perms)
+				if err == nil && ok {
+					return next(d)
+				}
+			}
+
+			if d.Context != nil {
+				_, err := d.Context.Reply(fmt.Sprintf("You need %s to use this command.", PermissionString(perms)))
+				return err
+			}
+			return nil
+		}
+	}
+}
+
+// Filter only continues when keep returns true.
+func Filter(keep func(*Dispatch) bool) Middleware {
+	return func(next DispatchFunc) DispatchFunc {
+		return func(d *Dispatch) error {
+			if !keep(d) {
+				return nil
+			}
+			return next(d)
+		}
+	}
+}
+
+func stringSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, s := range list {
+		set[s] = true
+	}
+	return set
+}
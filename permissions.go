@@ -0,0 +1,221 @@
+package godbot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Permissions missing from discordgo, and groups of permissions.
+const (
+	PermissionUseExternalStickers = 1 << 37
+	PermissionUseEmbeddedActivity = 1 << 39
+
+	// PermissionsAll is every permission, what owners and administrators have.
+	PermissionsAll = 1<<42 - 1
+
+	// PermissionsSend are the permissions that post in a text channel.
+	PermissionsSend = discordgo.PermissionSendMessages | discordgo.PermissionSendTTSMessages |
+		discordgo.PermissionAddReactions | discordgo.PermissionCreatePublicThreads |
+		discordgo.PermissionCreatePrivateThreads | discordgo.PermissionSendMessagesInThreads
+
+	// permissionsNeedSend are lost without Send Messages.
+	permissionsNeedSend = discordgo.PermissionSendTTSMessages | discordgo.PermissionEmbedLinks |
+		discordgo.PermissionAttachFiles | discordgo.PermissionMentionEveryone
+
+	// permissionsTimedOut are all a timed out member keeps.
+	permissionsTimedOut = discordgo.PermissionViewChannel | discordgo.PermissionReadMessageHistory
+)
+
+// permissionNames names every permission bit for PermissionString.
+var permissionNames = map[int64]string{
+	discordgo.PermissionCreateInstantInvite:   "Create Invite",
+	discordgo.PermissionKickMembers:           "Kick Members",
+	discordgo.PermissionBanMembers:            "Ban Members",
+	discordgo.PermissionAdministrator:         "Administrator",
+	discordgo.PermissionManageChannels:        "Manage Channels",
+	discordgo.PermissionManageServer:          "Manage Server",
+	discordgo.PermissionAddReactions:          "Add Reactions",
+	discordgo.PermissionViewAuditLogs:         "View Audit Log",
+	discordgo.PermissionVoicePrioritySpeaker:  "Priority Speaker",
+	discordgo.PermissionVoiceStreamVideo:      "Video",
+	discordgo.PermissionViewChannel:           "View Channel",
+	discordgo.PermissionSendMessages:          "Send Messages",
+	discordgo.PermissionSendTTSMessages:       "Send TTS Messages",
+	discordgo.PermissionManageMessages:        "Manage Messages",
+	discordgo.PermissionEmbedLinks:            "Embed Links",
+	discordgo.PermissionAttachFiles:           "Attach Files",
+	discordgo.PermissionReadMessageHistory:    "Read Message History",
+	discordgo.PermissionMentionEveryone:       "Mention Everyone",
+	discordgo.PermissionUseExternalEmojis:     "Use External Emojis",
+	discordgo.PermissionViewGuildInsights:     "View Server Insights",
+	discordgo.PermissionVoiceConnect:          "Connect",
+	discordgo.PermissionVoiceSpeak:            "Speak",
+	discordgo.PermissionVoiceMuteMembers:      "Mute Members",
+	discordgo.PermissionVoiceDeafenMembers:    "Deafen Members",
+	discordgo.PermissionVoiceMoveMembers:      "Move Members",
+	discordgo.PermissionVoiceUseVAD:           "Use Voice Activity",
+	discordgo.PermissionChangeNickname:        "Change Nickname",
+	discordgo.PermissionManageNicknames:       "Manage Nicknames",
+	discordgo.PermissionManageRoles:           "Manage Roles",
+	discordgo.PermissionManageWebhooks:        "Manage Webhooks",
+	discordgo.PermissionManageEmojis:          "Manage Emojis",
+	discordgo.PermissionUseSlashCommands:      "Use Application Commands",
+	discordgo.PermissionVoiceRequestToSpeak:   "Request to Speak",
+	discordgo.PermissionManageThreads:         "Manage Threads",
+	discordgo.PermissionCreatePublicThreads:   "Create Public Threads",
+	discordgo.PermissionCreatePrivateThreads:  "Create Private Threads",
+	PermissionUseExternalStickers:             "Use External Stickers",
+	discordgo.PermissionSendMessagesInThreads: "Send Messages in Threads",
+	PermissionUseEmbeddedActivity:             "Use Activities",
+	discordgo.PermissionModerateMembers:       "Timeout Members",
+}
+
+// PermissionString lists the names of the permissions set, separated by ", ".
+func PermissionString(perms int64) string {
+	var names []string
+	for bit := int64(1); bit <= perms && bit > 0; bit <<= 1 {
+		if perms&bit == 0 {
+			continue
+		}
+		if name, ok := permissionNames[bit]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("1<<%d", bitIndex(uint64(bit))))
+		}
+	}
+	if len(names) == 0 {
+		return "None"
+	}
+	return strings.Join(names, ", ")
+}
+
+// ComputePermissions works out the permissions of a member in a channel the
+// way discord does: @everyone and the member's roles give the base, the owner
+// and Administrator have everything, then the channel's @everyone, role and
+// member overwrites apply in that order. A nil channel returns the guild
+// permissions. Roles are the guild's roles.
+func ComputePermissions(guild *discordgo.Guild, roles []*discordgo.Role, member *discordgo.Member, channel *discordgo.Channel) int64 {
+	if member.User != nil && member.User.ID == guild.OwnerID {
+		return PermissionsAll
+	}
+
+	var perms int64
+	for _, r := range roles {
+		if r.ID == guild.ID || hasRole(member, r.ID) {
+			perms |= r.Permissions
+		}
+	}
+	if perms&discordgo.PermissionAdministrator != 0 {
+		return PermissionsAll
+	}
+
+	if channel != nil {
+		perms = applyOverwrites(perms, guild.ID, member, channel.PermissionOverwrites)
+
+		if perms&discordgo.PermissionViewChannel == 0 {
+			return 0
+		}
+		if perms&discordgo.PermissionSendMessages == 0 {
+			perms &^= permissionsNeedSend
+		}
+	}
+
+	if until := member.CommunicationDisabledUntil; until != nil && until.After(time.Now()) {
+		perms &= permissionsTimedOut
+	}
+	return perms
+}
+
+// applyOverwrites applies the @everyone overwrite, then the member's role
+// overwrites together and finally the member's own overwrite.
+func applyOverwrites(perms int64, gID string, member *discordgo.Member, overwrites []*discordgo.PermissionOverwrite) int64 {
+	var everyone, own *discordgo.PermissionOverwrite
+	var allow, deny int64
+	for _, ow := range overwrites {
+		switch {
+		case ow.Type == discordgo.PermissionOverwriteTypeRole && ow.ID == gID:
+			everyone = ow
+		case ow.Type == discordgo.PermissionOverwriteTypeRole && hasRole(member, ow.ID):
+			allow |= ow.Allow
+			deny |= ow.Deny
+		case ow.Type == discordgo.PermissionOverwriteTypeMember && member.User != nil && ow.ID == member.User.ID:
+			own = ow
+		}
+	}
+
+	if everyone != nil {
+		perms = perms&^everyone.Deny | everyone.Allow
+	}
+	perms = perms&^deny | allow
+	if own != nil {
+		perms = perms&^own.Deny | own.Allow
+	}
+	return perms
+}
+
+// MemberPermissions returns the permissions of a member in a channel, using
+// the caches and querying discord for what is missing. Threads use the
+// permissions of their parent channel.
+func (bot *Core) MemberPermissions(chID, uID string) (int64, error) {
+	channel, err := bot.channel(chID)
+	if err != nil {
+		return 0, err
+	}
+	if channel.IsThread() && channel.ParentID != "" {
+		if channel, err = bot.channel(channel.ParentID); err != nil {
+			return 0, err
+		}
+	}
+	if isPrivate(channel) {
+		return 0, ErrBadChannel
+	}
+
+	guild, ok := bot.Cache.Guild(channel.GuildID)
+	if !ok {
+		if guild, err = bot.Session.Guild(channel.GuildID); err != nil {
+			return 0, err
+		}
+	}
+
+	roles := bot.Cache.Roles(guild.ID)
+	if len(roles) == 0 {
+		roles = guild.Roles
+	}
+	if len(roles) == 0 {
+		if roles, err = bot.Session.GuildRoles(guild.ID); err != nil {
+			return 0, err
+		}
+	}
+
+	member, err := bot.GetMember(guild.ID, uID)
+	if err != nil {
+		return 0, err
+	}
+	return ComputePermissions(guild, roles, member, channel), nil
+}
+
+// HasPermissions checks if a member has every permission in perms in a channel.
+func (bot *Core) HasPermissions(chID, uID string, perms int64) (bool, error) {
+	have, err := bot.MemberPermissions(chID, uID)
+	if err != nil {
+		return false, err
+	}
+	return hasPermissions(have, perms), nil
+}
+
+// channel gets a channel from the cache, querying discord if it is missing.
+func (bot *Core) channel(chID string) (*discordgo.Channel, error) {
+	if c, ok := bot.Cache.Channel(chID); ok {
+		return c, nil
+	}
+	return bot.Session.Channel(chID)
+}
+
+// hasPermissions checks if perms has every permission in need, Administrator
+// has them all.
+func hasPermissions(perms, need int64) bool {
+	return perms&discordgo.PermissionAdministrator != 0 || perms&need == need
+}
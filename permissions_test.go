@@ -0,0 +1,135 @@
+package godbot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestComputePermissions(t *testing.T) {
+	const (
+		view    = discordgo.PermissionViewChannel
+		send    = discordgo.PermissionSendMessages
+		react   = discordgo.PermissionAddReactions
+		embed   = discordgo.PermissionEmbedLinks
+		history = discordgo.PermissionReadMessageHistory
+		manage  = discordgo.PermissionManageMessages
+	)
+
+	guild := &discordgo.Guild{ID: "g", OwnerID: "owner"}
+	roles := []*discordgo.Role{
+		{ID: "g", Permissions: view | send | react | embed | history},
+		{ID: "mod", Permissions: manage},
+		{ID: "admin", Permissions: discordgo.PermissionAdministrator},
+		{ID: "r1"},
+		{ID: "r2"},
+	}
+	role := func(id string, allow, deny int64) *discordgo.PermissionOverwrite {
+		return &discordgo.PermissionOverwrite{ID: id, Type: discordgo.PermissionOverwriteTypeRole, Allow: allow, Deny: deny}
+	}
+	member := func(id string, allow, deny int64) *discordgo.PermissionOverwrite {
+		return &discordgo.PermissionOverwrite{ID: id, Type: discordgo.PermissionOverwriteTypeMember, Allow: allow, Deny: deny}
+	}
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name       string
+		user       string
+		roles      []string
+		timeout    *time.Time
+		overwrites []*discordgo.PermissionOverwrite // Nil checks guild permissions.
+		want       int64
+	}{
+		{
+			name: "guild permissions combine @everyone and roles",
+			user: "u", roles: []string{"mod"},
+			want: view | send | react | embed | history | manage,
+		},
+		{
+			name: "owner has everything",
+			user: "owner", overwrites: []*discordgo.PermissionOverwrite{member("owner", 0, view)},
+			want: PermissionsAll,
+		},
+		{
+			name: "administrator ignores overwrites",
+			user: "u", roles: []string{"admin"},
+			overwrites: []*discordgo.PermissionOverwrite{role("g", 0, view), role("admin", 0, send)},
+			want:       PermissionsAll,
+		},
+		{
+			name: "role overwrite applies after @everyone",
+			user: "u", roles: []string{"r1"},
+			overwrites: []*discordgo.PermissionOverwrite{role("g", 0, send), role("r1", send, 0)},
+			want:       view | send | react | embed | history,
+		},
+		{
+			name: "allow wins between role overwrites",
+			user: "u", roles: []string{"r1", "r2"},
+			overwrites: []*discordgo.PermissionOverwrite{role("r1", 0, react), role("r2", react, 0)},
+			want:       view | send | react | embed | history,
+		},
+		{
+			name: "member overwrite applies after roles",
+			user: "u", roles: []string{"r1"},
+			overwrites: []*discordgo.PermissionOverwrite{role("r1", react, 0), member("u", 0, react)},
+			want:       view | send | embed | history,
+		},
+		{
+			name: "member overwrite allows what roles deny",
+			user: "u", roles: []string{"r1"},
+			overwrites: []*discordgo.PermissionOverwrite{role("g", 0, react), role("r1", 0, react), member("u", react, 0)},
+			want:       view | send | react | embed | history,
+		},
+		{
+			name: "overwrites of other roles and members are ignored",
+			user: "u", roles: []string{"r1"},
+			overwrites: []*discordgo.PermissionOverwrite{role("r2", 0, react), member("other", 0, send)},
+			want:       view | send | react | embed | history,
+		},
+		{
+			name: "no view channel means nothing",
+			user: "u", roles: []string{"mod"},
+			overwrites: []*discordgo.PermissionOverwrite{role("g", 0, view)},
+			want:       0,
+		},
+		{
+			name:       "no send messages loses what depends on it",
+			user:       "u",
+			overwrites: []*discordgo.PermissionOverwrite{role("g", 0, send)},
+			want:       view | react | history,
+		},
+		{
+			name: "timed out keeps view and history",
+			user: "u", roles: []string{"mod"}, timeout: &future,
+			overwrites: []*discordgo.PermissionOverwrite{},
+			want:       view | history,
+		},
+		{
+			name: "expired timeout is ignored",
+			user: "u", timeout: &past,
+			overwrites: []*discordgo.PermissionOverwrite{},
+			want:       view | send | react | embed | history,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &discordgo.Member{
+				User:                       &discordgo.User{ID: tt.user},
+				Roles:                      tt.roles,
+				CommunicationDisabledUntil: tt.timeout,
+			}
+			var channel *discordgo.Channel
+			if tt.overwrites != nil {
+				channel = &discordgo.Channel{ID: "c", GuildID: "g", PermissionOverwrites: tt.overwrites}
+			}
+
+			got := ComputePermissions(guild, roles, m, channel)
+			if got != tt.want {
+				t.Errorf("got %s, want %s", PermissionString(got), PermissionString(tt.want))
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package godbot
 
 import (
 	"errors"
+	"reflect"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -14,11 +17,16 @@ var (
 	ErrNotFound    = errors.New("godbot: not found")
 )
 
+// Limits used when querying guilds.
+const (
+	guildPageSize = 100 // Maximum guilds Discord returns per page.
+	guildWorkers  = 8   // Guilds fetched concurrently.
+)
+
 // Codes for types of Connections.
 const (
 	bwChannel = 1 << iota
 	bwGuild
-	bwLinks
 	bwPrivate
 )
 
@@ -29,14 +37,190 @@ func (bot *Core) GetConnections() (*Connections, error) {
 		return &Connections{}, err
 	}
 
-	return &Connections{Links: bot.Links, Guilds: bot.Guilds, Channels: bot.Channels}, nil
+	return &Connections{Links: bot.Links(), Guilds: bot.Guilds(), Channels: bot.Channels()}, nil
+
+}
+
+// Guilds returns a snapshot of the guilds the bot is in.
+func (bot *Core) Guilds() []*discordgo.Guild {
+	return bot.Cache.Guilds()
+}
 
+// Channels returns a snapshot of the channels in every guild.
+func (bot *Core) Channels() []*discordgo.Channel {
+	return bot.Cache.Channels()
 }
 
-// UpdateConnections is a public wrapper queries discord for all information needed by bot.
+// Private returns a snapshot of the direct and group message channels.
+func (bot *Core) Private() []*discordgo.Channel {
+	return bot.Cache.PrivateChannels()
+}
+
+// Links returns a snapshot map of [guild ID] -> channels.
+func (bot *Core) Links() map[string][]*discordgo.Channel {
+	links := make(map[string][]*discordgo.Channel)
+	for _, g := range bot.Cache.Guilds() {
+		links[g.ID] = bot.Cache.GuildChannels(g.ID)
+	}
+	return links
+}
+
+// UpdateConnections is a public wrapper queries discord for all information
+// needed by the bot's enabled features.
 func (bot *Core) UpdateConnections() error {
-	toUpdate := bwChannel | bwGuild | bwLinks | bwPrivate
-	return bot.updateConnections(toUpdate)
+	return bot.updateConnections(bot.connectionFlags())
+}
+
+// resyncConnections discards the cached connections and queries them again.
+func (bot *Core) resyncConnections() error {
+	_, err := bot.Reconcile()
+	return err
+}
+
+// Drift lists the IDs a reconciliation found wrong in the cached connections.
+type Drift struct {
+	GuildsAdded     []string
+	GuildsRemoved   []string
+	ChannelsAdded   []string
+	ChannelsRemoved []string
+	ChannelsChanged []string
+	PrivateAdded    []string
+	PrivateRemoved  []string
+}
+
+// Empty reports whether there was no drift to correct.
+func (d *Drift) Empty() bool {
+	return len(d.GuildsAdded)+len(d.GuildsRemoved)+
+		len(d.ChannelsAdded)+len(d.ChannelsRemoved)+len(d.ChannelsChanged)+
+		len(d.PrivateAdded)+len(d.PrivateRemoved) == 0
+}
+
+// Reconcile queries discord for every connection, replaces the cached
+// connections with the result and reports the drift it corrected. The cache is
+// left untouched if querying fails.
+func (bot *Core) Reconcile() (*Drift, error) {
+	fresh := &Core{Session: bot.Session, Cache: NewMemoryCache(), Features: bot.features()}
+	err := fresh.UpdateConnections()
+	if err != nil {
+		return nil, err
+	}
+
+	bot.muUpdate.Lock()
+	defer bot.muUpdate.Unlock()
+
+	c := bot.Cache
+	guilds := fresh.Guilds()
+	channels := fresh.Channels()
+	private := fresh.Private()
+
+	drift := &Drift{}
+	drift.GuildsAdded, drift.GuildsRemoved = diffIDs(guildIDs(c.Guilds()), guildIDs(guilds))
+	drift.ChannelsAdded, drift.ChannelsRemoved, drift.ChannelsChanged = diffChannels(c.Channels(), channels)
+	drift.PrivateAdded, drift.PrivateRemoved, _ = diffChannels(c.PrivateChannels(), private)
+
+	for _, gID := range drift.GuildsRemoved {
+		c.DeleteGuild(gID)
+	}
+	for _, cID := range drift.ChannelsRemoved {
+		c.DeleteChannel(cID)
+	}
+	for _, cID := range drift.PrivateRemoved {
+		c.DeleteChannel(cID)
+	}
+	for _, g := range guilds {
+		c.SetGuild(g)
+	}
+	for _, ch := range channels {
+		c.SetChannel(ch)
+	}
+	for _, ch := range private {
+		c.SetChannel(ch)
+	}
+	return drift, nil
+}
+
+// reconcileLoop reconciles the connections every interval until stopped.
+func (bot *Core) reconcileLoop(interval time.Duration, tracker *handlerTracker, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if !tracker.begin() {
+			return
+		}
+
+		drift, err := bot.Reconcile()
+		if err != nil {
+			bot.errorlog(err)
+		} else if !drift.Empty() && bot.rch != nil {
+			bot.rch(drift)
+		}
+		tracker.done()
+	}
+}
+
+func guildIDs(guilds []*discordgo.Guild) []string {
+	ids := make([]string, 0, len(guilds))
+	for _, g := range guilds {
+		ids = append(ids, g.ID)
+	}
+	return ids
+}
+
+// diffIDs returns the IDs only found in cur and the IDs only found in old.
+func diffIDs(old, cur []string) (added, removed []string) {
+	before := make(map[string]bool, len(old))
+	for _, id := range old {
+		before[id] = true
+	}
+	for _, id := range cur {
+		if !before[id] {
+			added = append(added, id)
+		}
+		delete(before, id)
+	}
+	for id := range before {
+		removed = append(removed, id)
+	}
+	return
+}
+
+// diffChannels compares two channel lists by ID and content.
+func diffChannels(old, cur []*discordgo.Channel) (added, removed, changed []string) {
+	before := make(map[string]*discordgo.Channel, len(old))
+	for _, c := range old {
+		before[c.ID] = c
+	}
+	for _, c := range cur {
+		o, ok := before[c.ID]
+		if !ok {
+			added = append(added, c.ID)
+			continue
+		}
+		delete(before, c.ID)
+		if channelChanged(o, c) {
+			changed = append(changed, c.ID)
+		}
+	}
+	for id := range before {
+		removed = append(removed, id)
+	}
+	return
+}
+
+// channelChanged compares the fields channel events keep current, fields such
+// as the last message ID are ignored.
+func channelChanged(a, b *discordgo.Channel) bool {
+	return a.Name != b.Name || a.Topic != b.Topic || a.Type != b.Type ||
+		a.Position != b.Position || a.ParentID != b.ParentID || a.NSFW != b.NSFW ||
+		a.Bitrate != b.Bitrate || a.UserLimit != b.UserLimit ||
+		!reflect.DeepEqual(a.PermissionOverwrites, b.PermissionOverwrites)
 }
 
 // updateConnections queries discord for specified information.
@@ -53,9 +237,6 @@ func (bot *Core) updateConnections(toUpdate int) error {
 		case toUpdate&bwChannel == bwChannel:
 			toUpdate = toUpdate ^ bwChannel
 			err = bot.queryChannels()
-		case toUpdate&bwLinks == bwLinks:
-			toUpdate = toUpdate ^ bwLinks
-			err = bot.queryLinks()
 		case toUpdate&bwPrivate == bwPrivate:
 			toUpdate = toUpdate ^ bwPrivate
 			err = bot.queryPrivate()
@@ -67,109 +248,113 @@ func (bot *Core) updateConnections(toUpdate int) error {
 	return nil
 }
 
-// queryLinks creates the map with [guild] -> [channels]
-func (bot *Core) queryLinks() error {
+// queryGuilds pulls all guilds associated with the bot, guilds the bot has
+// left are dropped.
+func (bot *Core) queryGuilds() error {
 	s := bot.Session
 
-	if bot.Guilds == nil {
-		return ErrNilGuilds
-	} else if bot.Links == nil {
-		bot.Links = make(map[string][]*discordgo.Channel)
-	}
-
-	for _, g := range bot.Guilds {
-		if _, ok := bot.Links[g.ID]; ok == false {
-			c, err := s.GuildChannels(g.ID)
-			if err != nil {
-				return err
-			}
+	// Page through every guild the bot is in.
+	var partial []*discordgo.UserGuild
+	var after string
+	for {
+		page, err := s.UserGuilds(guildPageSize, "", after)
+		if err != nil {
+			return err
+		}
 
-			bot.Links[g.ID] = c
+		partial = append(partial, page...)
+		if len(page) < guildPageSize {
+			break
 		}
+		after = page[len(page)-1].ID
 	}
 
-	return nil
-}
+	// Fetch the full guilds with a bounded number of workers.
+	guilds := make([]*discordgo.Guild, len(partial))
+	errs := make([]error, len(partial))
+	jobs := make(chan int)
 
-// queryGuilds pulls all guilds associated with the bot.
-func (bot *Core) queryGuilds() error {
-	var in bool
-	var err error
-	s := bot.Session
+	var wg sync.WaitGroup
+	for w := 0; w < guildWorkers && w < len(partial); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				guilds[n], errs[n] = s.Guild(partial[n].ID)
+			}
+		}()
+	}
 
-	// TAG: TODO - support over 100 guilds.
-	guilds, err := s.UserGuilds(100, "", "")
-	if err != nil {
-		return err
+	for n := range partial {
+		jobs <- n
 	}
+	close(jobs)
+	wg.Wait()
 
-	for _, g := range guilds {
-		guild, err := s.Guild(g.ID)
+	for _, err := range errs {
 		if err != nil {
 			return err
 		}
-		in = false
-		if bot.Guilds != nil {
-			for _, t := range bot.Guilds {
-				if t.ID == guild.ID {
-					in = true
-					break
-				}
-			}
-		}
-		if in == false {
-			bot.Guilds = append(bot.Guilds, guild)
+	}
+
+	// Forget the guilds the bot is no longer in.
+	in := make(map[string]bool, len(guilds))
+	for _, g := range guilds {
+		in[g.ID] = true
+		bot.Cache.SetGuild(bot.trimGuild(g))
+	}
+	for _, g := range bot.Cache.Guilds() {
+		if !in[g.ID] {
+			bot.Cache.DeleteGuild(g.ID)
 		}
 	}
 
 	return nil
 }
 
-// queryChannels just updates the core.channels slices with current guilds.
+// queryChannels updates the channels of every known guild.
 func (bot *Core) queryChannels() error {
 	s := bot.Session
 
-	if bot.Guilds == nil {
-		return ErrNilGuilds
-	}
-
-	bot.Channels = nil
-	for _, g := range bot.Guilds {
+	// Being in no guilds is valid, there is just nothing to query.
+	for _, g := range bot.Cache.Guilds() {
 		channels, err := s.GuildChannels(g.ID)
 		if err != nil {
 			return err
 		}
 
+		in := make(map[string]bool, len(channels))
 		for _, c := range channels {
-			bot.Channels = append(bot.Channels, c)
+			in[c.ID] = true
+			bot.Cache.SetChannel(c)
+		}
+		for _, c := range bot.Cache.GuildChannels(g.ID) {
+			if !in[c.ID] {
+				bot.Cache.DeleteChannel(c.ID)
+			}
 		}
 	}
 	return nil
 }
 
+// queryPrivate updates the direct and group message channels. Bots can not
+// list them over REST, the ones the session has seen are used.
 func (bot *Core) queryPrivate() error {
-	var in bool
 	s := bot.Session
 
-	private, err := s.UserChannels()
-	if err != nil {
-		return err
-	}
+	s.State.RLock()
+	private := make([]*discordgo.Channel, len(s.State.PrivateChannels))
+	copy(private, s.State.PrivateChannels)
+	s.State.RUnlock()
 
-	if len(private) > 0 {
-		for _, p := range private {
-			in = false
-			if bot.Private != nil {
-				for _, t := range bot.Private {
-					if t.ID == p.ID {
-						in = true
-						break
-					}
-				}
-			}
-			if in == false {
-				bot.Private = append(bot.Private, p)
-			}
+	in := make(map[string]bool, len(private))
+	for _, p := range private {
+		in[p.ID] = true
+		bot.Cache.SetChannel(p)
+	}
+	for _, p := range bot.Cache.PrivateChannels() {
+		if !in[p.ID] {
+			bot.Cache.DeleteChannel(p.ID)
 		}
 	}
 	return nil
@@ -182,7 +367,12 @@ func (bot *Core) ConnectionsReset() error {
 		return err
 	}
 
-	bot.GuildMain = bot.Guilds[0]
+	guilds := bot.Guilds()
+	if len(guilds) == 0 {
+		return ErrNilGuilds
+	}
+
+	bot.GuildMain = guilds[0]
 	bot.ChannelMain = bot.GetMainChannel(bot.GuildMain.ID)
 
 	return nil
@@ -0,0 +1,128 @@
+package godbot
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ConnectionState describes the state of the bot's gateway connection.
+type ConnectionState int
+
+// Connection states reported to the connection state handler.
+const (
+	StateDisconnected ConnectionState = iota
+	StateConnecting
+	StateReady
+	StateResuming
+)
+
+func (c ConnectionState) String() string {
+	switch c {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateReady:
+		return "ready"
+	case StateResuming:
+		return "resuming"
+	}
+	return fmt.Sprintf("ConnectionState(%d)", int(c))
+}
+
+// Backoff configures the wait between reconnect attempts. The wait starts at
+// Min, is multiplied by Factor after each failed attempt and never exceeds Max.
+type Backoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Factor float64
+}
+
+// DefaultBackoff is used for any Backoff field left at zero.
+var DefaultBackoff = Backoff{Min: time.Second, Max: 10 * time.Minute, Factor: 2}
+
+// delay returns how long to wait after the given failed attempt (0 based).
+func (b Backoff) delay(attempt int) time.Duration {
+	if b.Min <= 0 {
+		b.Min = DefaultBackoff.Min
+	}
+	if b.Max <= 0 {
+		b.Max = DefaultBackoff.Max
+	}
+	if b.Factor < 1 {
+		b.Factor = DefaultBackoff.Factor
+	}
+
+	d := float64(b.Min) * math.Pow(b.Factor, float64(attempt))
+	if d > float64(b.Max) {
+		return b.Max
+	}
+	return time.Duration(d)
+}
+
+// ConnectionState returns the current state of the gateway connection.
+func (bot *Core) ConnectionState() ConnectionState {
+	bot.muConn.Lock()
+	defer bot.muConn.Unlock()
+	return bot.connState
+}
+
+// setConnectionState records the new state and notifies the state handler.
+func (bot *Core) setConnectionState(state ConnectionState) {
+	bot.muConn.Lock()
+	old := bot.connState
+	bot.connState = state
+	handler := bot.csh
+	bot.muConn.Unlock()
+
+	if old != state && handler != nil {
+		handler(old, state)
+	}
+}
+
+// reconnect reopens the session, backing off between failed attempts, until it
+// succeeds or the bot is shut down. Only one reconnect loop runs at a time.
+func (bot *Core) reconnect(s *discordgo.Session) {
+	bot.muConn.Lock()
+	if bot.reconnecting {
+		bot.muConn.Unlock()
+		return
+	}
+	bot.reconnecting = true
+	stop := bot.stop
+	bot.muConn.Unlock()
+
+	defer func() {
+		bot.muConn.Lock()
+		bot.reconnecting = false
+		bot.muConn.Unlock()
+	}()
+
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		// Open resumes the previous session when it can, Discord answers
+		// with either RESUMED or a fresh READY.
+		bot.setConnectionState(StateResuming)
+		err := s.Open()
+		if err == nil || err == discordgo.ErrWSAlreadyOpen {
+			return
+		}
+
+		bot.errorlog(fmt.Errorf("godbot: reconnect attempt %d failed: %v", attempt+1, err))
+		bot.setConnectionState(StateDisconnected)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(bot.Backoff.delay(attempt)):
+		}
+	}
+}
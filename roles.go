@@ -0,0 +1,108 @@
+package godbot
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// GetRole gets a role of a guild based on Role ID.
+func (bot *Core) GetRole(gID, rID string) *discordgo.Role {
+	r, ok := bot.Cache.Role(gID, rID)
+	if !ok {
+		return nil
+	}
+	return r
+}
+
+// RolesByName returns every role in a guild with the name, ignoring case.
+func (bot *Core) RolesByName(gID, name string) (roles []*discordgo.Role) {
+	for _, r := range bot.Cache.Roles(gID) {
+		if strings.EqualFold(r.Name, name) {
+			roles = append(roles, r)
+		}
+	}
+	return
+}
+
+// RoleHierarchy returns the roles of a guild from the highest to the lowest.
+func (bot *Core) RoleHierarchy(gID string) []*discordgo.Role {
+	roles := bot.Cache.Roles(gID)
+	sort.SliceStable(roles, func(i, j int) bool {
+		return roleAbove(roles[i], roles[j])
+	})
+	return roles
+}
+
+// HighestRole returns the highest role a member of a guild has, the @everyone
+// role is returned for members without roles.
+func (bot *Core) HighestRole(gID, uID string) (*discordgo.Role, error) {
+	m, err := bot.member(gID, uID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The @everyone role shares its ID with the guild.
+	highest := bot.GetRole(gID, gID)
+	for _, rID := range m.Roles {
+		r := bot.GetRole(gID, rID)
+		if r == nil {
+			continue
+		}
+		if highest == nil || roleAbove(r, highest) {
+			highest = r
+		}
+	}
+
+	if highest == nil {
+		return nil, ErrNotFound
+	}
+	return highest, nil
+}
+
+// CanManageRole checks if the bot's highest role is above the role, which is
+// required before editing or assigning it. Owning the guild bypasses the check.
+func (bot *Core) CanManageRole(gID, rID string) (bool, error) {
+	if bot.User == nil {
+		return false, ErrNotReady
+	}
+
+	target := bot.GetRole(gID, rID)
+	if target == nil {
+		return false, ErrNotFound
+	}
+
+	if g, ok := bot.Cache.Guild(gID); ok && g.OwnerID == bot.User.ID {
+		return true, nil
+	}
+
+	highest, err := bot.HighestRole(gID, bot.User.ID)
+	if err != nil {
+		return false, err
+	}
+	return roleAbove(highest, target), nil
+}
+
+// member returns a member of a guild, querying discord if it is not cached.
+func (bot *Core) member(gID, uID string) (*discordgo.Member, error) {
+	if m, ok := bot.Cache.Member(gID, uID); ok {
+		return m, nil
+	}
+
+	m, err := bot.Session.GuildMember(gID, uID)
+	if err != nil {
+		return nil, err
+	}
+	bot.Cache.SetMember(gID, m)
+	return m, nil
+}
+
+// roleAbove orders roles the way discord does, by position with the older
+// role winning a tie.
+func roleAbove(a, b *discordgo.Role) bool {
+	if a.Position != b.Position {
+		return a.Position > b.Position
+	}
+	return idLess(a.ID, b.ID)
+}
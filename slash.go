@@ -0,0 +1,322 @@
+package godbot
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Slash command errors.
+var (
+	ErrBadSlashCommand    = errors.New("godbot: slash command needs a name, a description and a handler or subcommands")
+	ErrSlashCommandExists = errors.New("godbot: slash command already registered")
+	ErrNotReady           = errors.New("godbot: bot user is not known until ready")
+)
+
+// SlashCommand is an application command invoked with /name. A command
+// either has a Handler and Options, or Subcommands. A subcommand with
+// subcommands of its own is a group.
+type SlashCommand struct {
+	Name        string
+	Description string
+	Options     []*discordgo.ApplicationCommandOption
+	Subcommands []*SlashCommand
+	GuildIDs    []string // Guilds the command is registered in, global if empty.
+	Handler     func(*SlashContext) error
+}
+
+// valid checks the command and its subcommands, depth is the nesting level.
+func (cmd *SlashCommand) valid(depth int) bool {
+	if cmd == nil || cmd.Name == "" || cmd.Description == "" {
+		return false
+	} else if len(cmd.Subcommands) == 0 {
+		return cmd.Handler != nil
+	} else if depth == 2 || len(cmd.Options) > 0 {
+		// Subcommand groups can only hold subcommands.
+		return false
+	}
+
+	for _, sub := range cmd.Subcommands {
+		if !sub.valid(depth + 1) {
+			return false
+		}
+	}
+	return true
+}
+
+// applicationCommand converts the command to what discord registers.
+func (cmd *SlashCommand) applicationCommand() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Type:        discordgo.ChatApplicationCommand,
+		Name:        cmd.Name,
+		Description: cmd.Description,
+		Options:     cmd.options(),
+	}
+}
+
+func (cmd *SlashCommand) options() []*discordgo.ApplicationCommandOption {
+	if len(cmd.Subcommands) == 0 {
+		return cmd.Options
+	}
+
+	opts := make([]*discordgo.ApplicationCommandOption, len(cmd.Subcommands))
+	for n, sub := range cmd.Subcommands {
+		t := discordgo.ApplicationCommandOptionSubCommand
+		if len(sub.Subcommands) > 0 {
+			t = discordgo.ApplicationCommandOptionSubCommandGroup
+		}
+		opts[n] = &discordgo.ApplicationCommandOption{
+			Type:        t,
+			Name:        sub.Name,
+			Description: sub.Description,
+			Options:     sub.options(),
+		}
+	}
+	return opts
+}
+
+// subcommand finds a subcommand by name.
+func (cmd *SlashCommand) subcommand(name string) *SlashCommand {
+	for _, sub := range cmd.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// RegisterSlash adds a slash command. Commands registered before Start are
+// synced with discord once the bot is ready, later ones need SyncSlashCommands.
+func (bot *Core) RegisterSlash(cmd *SlashCommand) error {
+	if !cmd.valid(0) {
+		return ErrBadSlashCommand
+	}
+
+	bot.muSlash.Lock()
+	defer bot.muSlash.Unlock()
+	if _, ok := bot.slash[cmd.Name]; ok {
+		return ErrSlashCommandExists
+	}
+	if bot.slash == nil {
+		bot.slash = make(map[string]*SlashCommand)
+	}
+	bot.slash[cmd.Name] = cmd
+
+	if bot.slashSub == nil {
+		bot.slashSub, _ = bot.Subscribe(bot.slashDispatch, 0)
+	}
+	return nil
+}
+
+// UnregisterSlash removes a slash command, it is removed from discord on the
+// next sync.
+func (bot *Core) UnregisterSlash(name string) {
+	bot.muSlash.Lock()
+	defer bot.muSlash.Unlock()
+	delete(bot.slash, name)
+}
+
+// SlashCommands returns every registered slash command.
+func (bot *Core) SlashCommands() []*SlashCommand {
+	bot.muSlash.Lock()
+	defer bot.muSlash.Unlock()
+
+	cmds := make([]*SlashCommand, 0, len(bot.slash))
+	for _, cmd := range bot.slash {
+		cmds = append(cmds, cmd)
+	}
+	return cmds
+}
+
+// SyncSlashCommands makes the commands registered with discord match the
+// registered slash commands. Each scope, global or a guild, is compared with
+// what discord has: missing commands are created, changed ones edited and
+// ones no longer registered deleted. Only scopes with a registered command,
+// or synced with one before, are compared, so commands created by other means
+// are left alone.
+func (bot *Core) SyncSlashCommands() error {
+	bot.muSlash.Lock()
+	defer bot.muSlash.Unlock()
+
+	if bot.slashSub == nil {
+		return nil
+	}
+
+	appID := bot.applicationID()
+	if appID == "" {
+		return ErrNotReady
+	}
+
+	scopes := make(map[string][]*discordgo.ApplicationCommand)
+	for gID := range bot.slashScopes {
+		scopes[gID] = nil
+	}
+	for _, cmd := range bot.slash {
+		ac := cmd.applicationCommand()
+		if len(cmd.GuildIDs) == 0 {
+			scopes[""] = append(scopes[""], ac)
+			continue
+		}
+		for _, gID := range cmd.GuildIDs {
+			scopes[gID] = append(scopes[gID], ac)
+		}
+	}
+
+	synced := make(map[string]bool, len(scopes))
+	for gID, want := range scopes {
+		if err := bot.syncScope(appID, gID, want); err != nil {
+			return fmt.Errorf("godbot: syncing commands for %q: %v", gID, err)
+		}
+		if len(want) > 0 {
+			synced[gID] = true
+		}
+	}
+	bot.slashScopes = synced
+	return nil
+}
+
+// syncScope syncs the commands of one guild, or the global ones for "".
+func (bot *Core) syncScope(appID, gID string, want []*discordgo.ApplicationCommand) error {
+	s := bot.Session
+	have, err := s.ApplicationCommands(appID, gID)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]*discordgo.ApplicationCommand, len(have))
+	for _, ac := range have {
+		existing[ac.Name] = ac
+	}
+
+	for _, ac := range want {
+		old, ok := existing[ac.Name]
+		delete(existing, ac.Name)
+		switch {
+		case !ok:
+			_, err = s.ApplicationCommandCreate(appID, gID, ac)
+		case !sameCommand(old, ac):
+			_, err = s.ApplicationCommandEdit(appID, gID, old.ID, ac)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, old := range existing {
+		if err := s.ApplicationCommandDelete(appID, gID, old.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applicationID is the bot's user ID, which is also its application ID.
+func (bot *Core) applicationID() string {
+	if bot.User != nil {
+		return bot.User.ID
+	}
+	if bot.Session != nil && bot.Session.State != nil && bot.Session.State.User != nil {
+		return bot.Session.State.User.ID
+	}
+	return ""
+}
+
+// slashDispatch routes application command interactions to their handler.
+func (bot *Core) slashDispatch(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+
+	data := i.ApplicationCommandData()
+	bot.muSlash.Lock()
+	cmd := bot.slash[data.Name]
+	bot.muSlash.Unlock()
+	if cmd == nil {
+		return
+	}
+
+	ctx := &SlashContext{
+		InteractionContext: InteractionContext{Core: bot, Session: s, Interaction: i.Interaction},
+		Path:               cmd.Name,
+		Options:            data.Options,
+	}
+
+	// Walk down to the subcommand that was invoked.
+	for len(cmd.Subcommands) > 0 && len(ctx.Options) > 0 {
+		sub := cmd.subcommand(ctx.Options[0].Name)
+		if sub == nil {
+			return
+		}
+		cmd = sub
+		ctx.Path += " " + sub.Name
+		ctx.Options = ctx.Options[0].Options
+	}
+	if cmd.Handler == nil {
+		return
+	}
+	ctx.Command = cmd
+
+	if err := cmd.Handler(ctx); err != nil {
+		bot.errorlog(fmt.Errorf("godbot: slash command %s: %v", ctx.Path, err))
+		ctx.fail()
+	}
+}
+
+// SlashContext is passed to a slash command's handler.
+type SlashContext struct {
+	InteractionContext
+	Command *SlashCommand
+	Path    string // Command and subcommands invoked, such as "config set".
+	Options []*discordgo.ApplicationCommandInteractionDataOption
+}
+
+// Option finds an option given to the command, nil if it was not given.
+func (ctx *SlashContext) Option(name string) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, opt := range ctx.Options {
+		if opt.Name == name {
+			return opt
+		}
+	}
+	return nil
+}
+
+// sameCommand compares the parts of two commands that are registered.
+func sameCommand(a, b *discordgo.ApplicationCommand) bool {
+	return a.Name == b.Name && a.Description == b.Description && sameOptions(a.Options, b.Options)
+}
+
+func sameOptions(a, b []*discordgo.ApplicationCommandOption) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		x, y := a[n], b[n]
+		if x.Type != y.Type || x.Name != y.Name || x.Description != y.Description ||
+			x.Required != y.Required || x.Autocomplete != y.Autocomplete || x.MaxValue != y.MaxValue {
+			return false
+		}
+		if (x.MinValue == nil) != (y.MinValue == nil) || (x.MinValue != nil && *x.MinValue != *y.MinValue) {
+			return false
+		}
+		if len(x.ChannelTypes) != len(y.ChannelTypes) || len(x.Choices) != len(y.Choices) {
+			return false
+		}
+		for i := range x.ChannelTypes {
+			if x.ChannelTypes[i] != y.ChannelTypes[i] {
+				return false
+			}
+		}
+		for i := range x.Choices {
+			// Values come back from discord as JSON numbers or strings.
+			if x.Choices[i].Name != y.Choices[i].Name ||
+				fmt.Sprint(x.Choices[i].Value) != fmt.Sprint(y.Choices[i].Value) {
+				return false
+			}
+		}
+		if !sameOptions(x.Options, y.Options) {
+			return false
+		}
+	}
+	return true
+}
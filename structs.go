@@ -2,7 +2,9 @@ package godbot
 
 import (
 	"log"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -20,44 +22,76 @@ type Core struct {
 
 	Stream   bool
 	Game     string
-	LiteMode bool // If it loads EVERYTHING.
+	Features Features // Parts of the bot that are active.
+	LiteMode bool     // Deprecated: same as Features set to FeaturesNone.
+
+	// Gateway intents. Intents overrides the computed intents when set,
+	// RequestPrivileged opts in to privileged intents.
+	Intents           discordgo.Intent
+	RequestPrivileged discordgo.Intent
+	activeIntents     discordgo.Intent
 
 	// Ready channel
-	ready chan string
+	ready chan error
 	Ready *discordgo.Ready
 
+	// Lifecycle state.
+	muState        sync.Mutex
+	running        bool
+	removeDispatch func()
+	inflight       *handlerTracker
+
+	// Connection state and reconnect supervision.
+	Backoff      Backoff
+	muConn       sync.Mutex
+	connState    ConnectionState
+	reconnecting bool
+	stop         chan struct{}
+	csh          func(old, new ConnectionState)
+
+	// Full reconciliation of the connection cache, disabled when zero.
+	ReconcileInterval time.Duration
+	rch               func(*Drift)
+
 	// Connection Information.
 	Session     *discordgo.Session
 	ChannelMain *discordgo.Channel
-	Channels    []*discordgo.Channel
 	GuildMain   *discordgo.Guild
-	Guilds      []*discordgo.Guild
 
-	// Link map: [guild ID] []*Channels
-	Links   map[string][]*discordgo.Channel
-	Private []*discordgo.Channel
+	// Cache of guilds, channels, roles and members.
+	Cache         Cache
+	muMembers     sync.Mutex
+	membersLoaded map[string]bool // [guild ID] all member chunks received
+
+	// Event bus for every handler.
+	bus eventBus
 
-	// Message handling functions.
-	mch func(*discordgo.Session, *discordgo.MessageCreate)
-	muh func(*discordgo.Session, *discordgo.MessageUpdate)
+	// Command router and event middleware.
+	muRouter   sync.Mutex
+	router     *Router
+	routerSub  *Subscription
+	middleware []Middleware
 
-	// Member handlers
-	gmah func(*discordgo.Session, *discordgo.GuildMemberAdd)
-	gmuh func(*discordgo.Session, *discordgo.GuildMemberUpdate)
-	gmrh func(*discordgo.Session, *discordgo.GuildMemberRemove)
+	// Slash commands.
+	muSlash     sync.Mutex
+	slash       map[string]*SlashCommand // [name] command
+	slashSub    *Subscription
+	slashScopes map[string]bool // Guild IDs synced before, "" is global.
 
-	// Guild handlers
-	gah  func(*discordgo.Session, *discordgo.GuildCreate)
-	gruh func(*discordgo.Session, *discordgo.GuildRoleUpdate)
-	grdh func(*discordgo.Session, *discordgo.GuildRoleDelete)
+	// Message components.
+	components components
 
-	// Channel handlers
-	cuh func(*discordgo.Session, *discordgo.ChannelUpdate)
-	cdh func(*discordgo.Session, *discordgo.ChannelDelete)
+	// Channel locks, persisted to LockStore (in memory if nil).
+	LockStore   LockStore
+	LockProfile *LockProfile // Used by locks without their own profile.
+	muLocks     sync.Mutex
+	locks       map[string]*ChannelLock // [channel ID] active lock
+	lockdowns   map[string]*Lockdown    // [lockdown ID] active lockdown
 
 	// Logging for Errors.
-	muLog  sync.Mutex
-	errlog *log.Logger
+	muLog   sync.Mutex
+	errlog  *log.Logger
+	logFile *os.File
 }
 
 // Connections holds all connection data.
@@ -88,11 +122,23 @@ type Channel struct {
 
 // ChannelLock holds Locking information for a Channel.
 type ChannelLock struct {
-	Locked     bool
-	Session    *discordgo.Session
-	Guild      *Guild
-	Channel    *Channel
-	Roles      []*discordgo.Role
-	Overwrites []*discordgo.PermissionOverwrite
-	Message    *discordgo.Message
+	Locked       bool
+	UnlockButton bool // Adds an Unlock button to the notice, for members with Manage Channels.
+	Session      *discordgo.Session
+	Guild        *Guild
+	Channel      *Channel
+	Roles        []*discordgo.Role
+	Overwrites   []*discordgo.PermissionOverwrite // Before the lock.
+	Created      []string                         // IDs of overwrites the lock added, deleted on unlock.
+	Profile      *LockProfile                     // What is denied, Core.LockProfile if nil.
+	Message      *discordgo.Message
+	Expires      time.Time // When a timed lock unlocks, zero if it does not.
+	LockedAt     time.Time
+	LockedBy     string // ID of the user that locked the channel, for the lock record.
+	Reason       string
+
+	mu    sync.Mutex
+	bot   *Core
+	timer *time.Timer
+	retry time.Duration // Delay before retrying a failed expiry.
 }
@@ -4,10 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+// Custom ID of the Unlock button on lock notices.
+const unlockButtonID = "godbot.unlock"
+
 // Constants for locked channels.
 var (
 	ErrChannelNotLocked = errors.New("channel is not locked")
@@ -15,28 +19,27 @@ var (
 	ErrNilChannelLock   = errors.New("provided a nil channel lock")
 	ErrBadChannel       = errors.New("bad channel for operation")
 	ErrBadGuild         = errors.New("bad guild for operation")
+	ErrBadTag           = errors.New("invalid name provided, expected Username#Discriminator")
+	ErrBadDuration      = errors.New("duration must be positive")
 )
 
 // GetMainChannel sets the main channel for the bot.
 func (bot *Core) GetMainChannel(gID string) *discordgo.Channel {
-	c := bot.Links[gID]
-	for _, p := range c {
-		if p.ID == gID {
-			return p
-		}
+	c, ok := bot.Cache.Channel(gID)
+	if !ok || c.GuildID != gID {
+		return nil
 	}
-	return nil
+	return c
 }
 
 // SetMainChannel sets the channel to primarily sit in.
 func (bot *Core) SetMainChannel(gID, cID string) error {
-	for _, p := range bot.Links[gID] {
-		if p.ID == cID {
-			bot.ChannelMain = p
-			return nil
-		}
+	c, ok := bot.Cache.Channel(cID)
+	if !ok || c.GuildID != gID {
+		return ErrNotFound
 	}
-	return ErrNotFound
+	bot.ChannelMain = c
+	return nil
 }
 
 // SetMainGuild assigns the guild and channel to the main server.
@@ -49,156 +52,319 @@ func (bot *Core) SetMainGuild(gID string) {
 
 // GetChannel gets a Channel struct based on Channel ID.
 func (bot *Core) GetChannel(cID string) *Channel {
-	for _, p := range bot.Channels {
-		if p.ID == cID {
-			return &Channel{Channel: p}
-		}
+	c, ok := bot.Cache.Channel(cID)
+	if !ok {
+		return nil
 	}
-	return nil
+	return &Channel{Channel: c}
 }
 
 // GetGuild gets a Guild structure from a Guild ID.
 func (bot *Core) GetGuild(gID string) *Guild {
-	for _, p := range bot.Guilds {
-		if p.ID == gID {
-			return &Guild{Guild: p}
-		}
+	g, ok := bot.Cache.Guild(gID)
+	if !ok {
+		return nil
 	}
-	return nil
+	return &Guild{Guild: g}
 }
 
 // GetGuildID gets the ID of a guild from a Channel ID.
 func (bot *Core) GetGuildID(cID string) (string, error) {
-	if bot.Links == nil {
-		return "", ErrNilLinks
+	c, ok := bot.Cache.Channel(cID)
+	if !ok || isPrivate(c) {
+		return "", ErrNotFound
 	}
-	for guild, channels := range bot.Links {
-		for _, c := range channels {
-			if c.ID == cID {
-				return guild, nil
-			}
-		}
-	}
-	return "", ErrNotFound
+	return c.GuildID, nil
 }
 
-// ChannelLockCreate returns a ChannelLock struct.
+// ChannelLockCreate returns a ChannelLock struct. A channel that is already
+// locked returns its active lock.
 func (bot *Core) ChannelLockCreate(cID string) (*ChannelLock, error) {
+	if cl := bot.ActiveLock(cID); cl != nil {
+		return cl, nil
+	}
+
 	s := bot.Session
 	var cl = &ChannelLock{}
-	//var f bool
 
 	cl.Session = s
+	cl.bot = bot
 	cl.Channel = bot.GetChannel(cID)
+	if cl.Channel == nil {
+		return nil, ErrNotFound
+	}
 	cl.Guild = bot.GetGuild(cl.Channel.GuildID)
 
-	if cl.Channel.Type != 0 {
+	if !lockable(cl.Channel.Type) {
 		return nil, ErrBadChannel
 	}
 
 	for _, p := range cl.Channel.PermissionOverwrites {
 		cl.Overwrites = append(cl.Overwrites, p)
-		r, err := s.State.Role(cl.Guild.ID, p.ID)
-		if err != nil {
-			return nil, err
+		if p.Type != discordgo.PermissionOverwriteTypeRole {
+			continue
+		}
+		if r := bot.GetRole(cl.Channel.GuildID, p.ID); r != nil {
+			cl.Roles = append(cl.Roles, r)
 		}
-
-		cl.Roles = append(cl.Roles, r)
 	}
 
 	return cl, nil
 }
 
-// ChannelLock will lock a channel preventing @everyone typing.
+// OverwriteError is a permission overwrite that could not be changed.
+type OverwriteError struct {
+	ID   string // Role or member ID.
+	Type discordgo.PermissionOverwriteType
+	Err  error
+}
+
+func (e *OverwriteError) Error() string {
+	kind := "role"
+	if e.Type == discordgo.PermissionOverwriteTypeMember {
+		kind = "member"
+	}
+	return fmt.Sprintf("%s %s: %v", kind, e.ID, e.Err)
+}
+
+// Unwrap returns the error from discord.
+func (e *OverwriteError) Unwrap() error {
+	return e.Err
+}
+
+// LockError reports what failed while locking or unlocking a channel. A failed
+// lock is undone, when undoing it fails too the channel is left locked without
+// a timer so ChannelUnlock can restore it. A failed unlock leaves the channel
+// locked so ChannelUnlock can be retried.
+type LockError struct {
+	ChannelID  string
+	Unlocking  bool
+	Err        error             // Failure besides the overwrites, such as sending the notice.
+	Overwrites []*OverwriteError // Overwrites that failed to change.
+	Rollback   []*OverwriteError // Overwrites that failed to be restored after a failed lock.
+}
+
+func (e *LockError) Error() string {
+	op := "locking"
+	if e.Unlocking {
+		op = "unlocking"
+	}
+
+	var failed []string
+	if e.Err != nil {
+		failed = append(failed, e.Err.Error())
+	}
+	for _, ow := range e.Overwrites {
+		failed = append(failed, ow.Error())
+	}
+	for _, ow := range e.Rollback {
+		failed = append(failed, "undoing "+ow.Error())
+	}
+	return fmt.Sprintf("godbot: %s %s: %s", op, e.ChannelID, strings.Join(failed, "; "))
+}
+
+// Unwrap returns the failure besides the overwrites.
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
+
+// ChannelLock will lock a channel, denying the permissions of its profile to
+// every role and member that is not exempt.
 func (cl *ChannelLock) ChannelLock(alert bool) error {
-	//var timeoutRole, everyoneRole, everyoneRoleBak *discordgo.Role
-	// Get current Roles permissions.
 	if cl == nil {
 		return ErrNilChannelLock
 	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.lock(alert)
+}
+
+// lock applies the lock, the mutex must be held.
+func (cl *ChannelLock) lock(alert bool) error {
 	if cl.Locked {
 		return nil
 	}
 
 	s := cl.Session
-	for _, ow := range cl.Overwrites {
-		r, err := cl.overwriteRole(ow.ID)
+	if failed := cl.apply(); len(failed) > 0 {
+		return cl.undo(nil, failed)
+	}
+
+	if alert {
+		msg := &discordgo.MessageSend{
+			Embeds:     []*discordgo.MessageEmbed{cl.noticeEmbed()},
+			Components: cl.noticeComponents(),
+		}
+
+		var err error
+		cl.Message, err = s.ChannelMessageSendComplex(cl.Channel.ID, msg)
 		if err != nil {
-			fmt.Println("getting role from overwrite id", err)
-			continue
+			cl.Message = nil
+			return cl.undo(err, nil)
 		}
 
-		nA := ow.Allow
-		if ow.Allow&2048 == 2048 {
-			nA = ow.Allow ^ 2048
+		if msg.Components != nil {
+			err = cl.bot.AddComponent(&Component{
+				CustomID:    unlockButtonID,
+				MessageID:   cl.Message.ID,
+				Permissions: discordgo.PermissionManageChannels,
+				Handler:     cl.unlockPressed,
+			})
+			if err != nil {
+				return cl.undo(err, nil)
+			}
 		}
+	}
+
+	cl.Locked = true
+	cl.LockedAt = time.Now()
+	cl.save()
+	return nil
+}
 
-		err = s.ChannelPermissionSet(cl.Channel.ID, r.ID, ow.Type, nA, ow.Deny|2048)
+// undo rolls back a lock that failed after its overwrites were applied, the
+// mutex must be held. When the overwrites cannot be restored the channel is
+// kept locked, without a timer, so ChannelUnlock can retry.
+func (cl *ChannelLock) undo(err error, failed []*OverwriteError) error {
+	lerr := &LockError{ChannelID: cl.Channel.ID, Err: err, Overwrites: failed}
+	lerr.Rollback = cl.restore()
+	if len(lerr.Rollback) == 0 {
+		if cl.Message != nil {
+			cl.Session.ChannelMessageDelete(cl.Channel.ID, cl.Message.ID)
+			cl.Message = nil
+		}
+		return lerr
+	}
+
+	cl.Expires = time.Time{}
+	cl.Locked = true
+	cl.LockedAt = time.Now()
+	cl.save()
+	return lerr
+}
+
+// apply denies the profile's permissions on the channel's overwrites and adds
+// the missing ones, the mutex must be held.
+func (cl *ChannelLock) apply() []*OverwriteError {
+	var failed []*OverwriteError
+	set := func(id string, t discordgo.PermissionOverwriteType, allow, deny int64) bool {
+		err := cl.Session.ChannelPermissionSet(cl.Channel.ID, id, t, allow, deny)
 		if err != nil {
-			return err
+			failed = append(failed, &OverwriteError{ID: id, Type: t, Err: err})
 		}
+		return err == nil
 	}
 
-	if alert {
-		d := fmt.Sprintf("**%s** channel is temporarily __**locked**__ for maintenance.\n%4s message will disappear when it is available.", cl.Channel.Name, "This")
-
-		// Embed create.
-		em := &discordgo.MessageEmbed{
-			Author:      &discordgo.MessageEmbedAuthor{},
-			Color:       0x800000,
-			Description: d,
-			Fields:      []*discordgo.MessageEmbedField{},
+	prof := cl.profile()
+	perms := prof.deny(cl.Channel.Type)
+	for _, ow := range cl.Overwrites {
+		allow, deny := ow.Allow&^perms, ow.Deny|perms
+		switch {
+		case ow.Type == discordgo.PermissionOverwriteTypeMember && prof.PreserveMembers:
+			continue
+		case ow.Type == discordgo.PermissionOverwriteTypeRole && prof.exempt(ow.ID):
+			allow, deny = ow.Allow|cl.exemptAllow(ow.ID, perms), ow.Deny
 		}
-		var err error
-		cl.Message, err = s.ChannelMessageSendEmbed(cl.Channel.ID, em)
+		set(ow.ID, ow.Type, allow, deny)
+	}
+
+	// Roles without an overwrite: @everyone, and exempt roles that would be
+	// denied through it.
+	missing := prof.ExemptRoles
+	if !prof.NoEveryone {
+		missing = append([]string{cl.Channel.GuildID}, missing...)
+	}
+	cl.Created = nil
+	for _, id := range missing {
+		if cl.hasOverwrite(id) || containsString(cl.Created, id) {
+			continue
+		}
+
+		allow, deny := int64(0), perms
+		if prof.exempt(id) {
+			allow, deny = cl.exemptAllow(id, perms), 0
+			if allow == 0 {
+				continue // The role had none of them.
+			}
+		}
+		if set(id, discordgo.PermissionOverwriteTypeRole, allow, deny) {
+			cl.Created = append(cl.Created, id)
+		}
+	}
+	return failed
+}
+
+// restore sets the overwrites back to how they were before the lock and
+// deletes the ones it added, the mutex must be held. Added overwrites that
+// fail to delete are kept in Created.
+func (cl *ChannelLock) restore() []*OverwriteError {
+	var failed []*OverwriteError
+	s := cl.Session
+	for _, ow := range cl.Overwrites {
+		err := s.ChannelPermissionSet(cl.Channel.ID, ow.ID, ow.Type, ow.Allow, ow.Deny)
 		if err != nil {
-			return err
+			failed = append(failed, &OverwriteError{ID: ow.ID, Type: ow.Type, Err: err})
 		}
-		// End Embed send.
 	}
 
-	cl.Locked = true
-	return nil
+	var kept []string
+	for _, id := range cl.Created {
+		if err := s.ChannelPermissionDelete(cl.Channel.ID, id); err != nil {
+			failed = append(failed, &OverwriteError{ID: id, Type: discordgo.PermissionOverwriteTypeRole, Err: err})
+			kept = append(kept, id)
+		}
+	}
+	cl.Created = kept
+	return failed
 }
 
-// ChannelUnlock will unlock a channel allowing for @everyone to type.
+// ChannelUnlock will unlock a channel, restoring its overwrites and removing
+// the ones the lock added. The timer of a timed lock is stopped. When
+// overwrites fail to restore a *LockError lists them and the channel stays
+// locked.
 func (cl *ChannelLock) ChannelUnlock() error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
 	if cl.Locked != true {
 		return ErrChannelNotLocked
 	}
 
 	s := cl.Session
-	for _, ow := range cl.Overwrites {
-		r, err := cl.overwriteRole(ow.ID)
-		if err != nil {
-			fmt.Println("getting role from overwrite id", err)
-			continue
-		}
-
-		err = s.ChannelPermissionSet(cl.Channel.ID, r.ID, ow.Type, ow.Allow, ow.Deny)
-		if err != nil {
-			fmt.Printf("[ERROR] Could not unlock!\n Channel: %s -> Role: %s, ID: %s\n Overwrite Dump: %#v", cl.Channel.Name, r.Name, r.ID, ow)
-			return err
-		}
+	if failed := cl.restore(); len(failed) > 0 {
+		cl.save()
+		return &LockError{ChannelID: cl.Channel.ID, Unlocking: true, Overwrites: failed}
 	}
 
+	// The channel is unlocked, a notice that fails to go does not change that.
+	cl.stopTimer()
 	if cl.Message != nil {
+		if cl.bot != nil {
+			cl.bot.RemoveComponents(cl.Message.ID)
+		}
 		err := s.ChannelMessageDelete(cl.Channel.ID, cl.Message.ID)
-		if err != nil {
-			return err
+		if err != nil && !notFound(err, discordgo.ErrCodeUnknownMessage) && cl.bot != nil {
+			cl.bot.errorlog(fmt.Errorf("godbot: deleting lock notice in %s: %v", cl.Channel.ID, err))
 		}
+		cl.Message = nil
 	}
 	cl.Locked = false
+	cl.forget()
 	return nil
 }
 
-func (cl *ChannelLock) overwriteRole(oID string) (*discordgo.Role, error) {
-	for _, r := range cl.Roles {
-		if r.ID == oID {
-			return r, nil
-		}
+// unlockPressed unlocks the channel from the notice's Unlock button. Restoring
+// every overwrite can outlast the interaction deadline, so it is deferred.
+func (cl *ChannelLock) unlockPressed(ctx *ComponentContext) error {
+	if err := ctx.Defer(true); err != nil {
+		return err
+	}
+	if err := cl.ChannelUnlock(); err != nil {
+		return err
 	}
-	return nil, ErrNotFound
+	_, err := ctx.Followup(fmt.Sprintf("**%s** unlocked.", cl.Channel.Name), true)
+	return err
 }
 
 // SetNickname will set the current name of the bot to the guild.
@@ -223,38 +389,17 @@ func (bot *Core) SetNickname(gID, name string, append bool) error {
 
 // UserID turns a Username#Discriminator into an ID.
 func (bot *Core) UserID(name string) (string, error) {
-	s := bot.Session
-	uname := strings.Split(name, "#")
-	if len(uname) < 2 {
-		return "", fmt.Errorf("invalid name provided: %s", name)
-	}
-	for {
-		for _, g := range bot.Guilds {
-			var uID string
-
-			users, err := s.GuildMembers(g.ID, uID, 100)
-			if err != nil {
-				return "", err
-			}
-			ulen := len(users)
-			for n, u := range users {
-				uID = u.User.ID
-				if u.User.Username == uname[0] && u.User.Discriminator == uname[1] {
-					return uID, nil
-				}
-				if n+1 == ulen && ulen < 100 {
-					return "", fmt.Errorf("user not found")
-				}
-			}
-
-		}
+	m, err := bot.memberByTagAnyGuild(name, "", nil)
+	if err != nil {
+		return "", err
 	}
+	return m.User.ID, nil
 }
 
 // GuildsString converts the entire guild list into string format.
 func (bot *Core) GuildsString() string {
 	var ret = fmt.Sprintf("%20s -> %s\n", "Guild ID", "Guild Name")
-	for _, g := range bot.Guilds {
+	for _, g := range bot.Guilds() {
 		ret += fmt.Sprintf("%20s -> %s\n", g.ID, g.Name)
 	}
 	return ret
@@ -264,7 +409,7 @@ func (bot *Core) GuildsString() string {
 // infoType defaults to Guild ID, if infoType is set to "name" it will return names.
 // otherwise it will return the IDs.
 func (bot *Core) GuildToSlice(infoType string) (guilds []string) {
-	for _, g := range bot.Guilds {
+	for _, g := range bot.Guilds() {
 		if strings.ToLower(infoType) == "name" {
 			guilds = append(guilds, g.Name)
 		} else {
@@ -283,11 +428,11 @@ func (bot *Core) ChannelToSlice(guildID, infoType string) (channels []string) {
 	}
 
 	// Make sure we have that guild ID in our links.
-	if _, ok := bot.Links[guildID]; !ok {
+	if _, ok := bot.Cache.Guild(guildID); !ok {
 		return
 	}
 
-	for _, c := range bot.Links[guildID] {
+	for _, c := range bot.Cache.GuildChannels(guildID) {
 		if strings.ToLower(infoType) == "name" {
 			channels = append(channels, c.Name)
 		} else {
@@ -297,108 +442,34 @@ func (bot *Core) ChannelToSlice(guildID, infoType string) (channels []string) {
 	return
 }
 
-// ChannelMemoryDelete will remove a channel from the array of channels in memory.
+// ChannelMemoryDelete will remove a channel from the channels in memory.
 func (bot *Core) ChannelMemoryDelete(channel *discordgo.Channel) {
-	bot.muUpdate.Lock()
-	defer bot.muUpdate.Unlock()
-
-	if len(bot.Channels) <= 1 {
-		bot.Channels = nil
-	} else {
-		// Search the list of ALL channels.
-		for n, c := range bot.Channels {
-			// Find our channel...
-			if c.ID == channel.ID {
-				bot.Channels[n] = bot.Channels[len(bot.Channels)-1]
-				bot.Channels[len(bot.Channels)-1] = nil
-				bot.Channels = bot.Channels[:len(bot.Channels)-1]
-				break
-			}
-		}
-	}
-
-	if len(bot.Links[channel.GuildID]) <= 1 {
-		bot.Links[channel.GuildID] = nil
-	} else {
-		// Search links.
-		for n, c := range bot.Links[channel.GuildID] {
-			// Find our channel...
-			if c.ID == channel.ID {
-				bot.Links[channel.GuildID][n] = bot.Links[channel.GuildID][len(bot.Links[channel.GuildID])-1]
-				bot.Links[channel.GuildID][len(bot.Links[channel.GuildID])-1] = nil
-				bot.Links[channel.GuildID] = bot.Links[channel.GuildID][:len(bot.Links[channel.GuildID])-1]
-				break
-			}
-		}
-	}
-
-	return
+	bot.Cache.DeleteChannel(channel.ID)
 }
 
 // ChannelMemoryAdd will Add/Replace a channels structure in memory.
 func (bot *Core) ChannelMemoryAdd(channel *discordgo.Channel) {
-	bot.muUpdate.Lock()
-	defer bot.muUpdate.Unlock()
-
-	// Search the entire channels list, and modify or append.
-	var exists bool
-	for n, c := range bot.Channels {
-		if c.ID == channel.ID {
-			exists = true
-			bot.Channels[n] = channel
-			break
-		}
-	}
-
-	// Append it since it wasn't found.
-	if !exists {
-		bot.Channels = append(bot.Channels, channel)
-	}
-
-	exists = false
-	// Search our guild link and modify it.
-	for n, c := range bot.Links[channel.GuildID] {
-		if c.ID == channel.ID {
-			exists = true
-			bot.Links[channel.GuildID][n] = channel
-			break
-		}
-	}
-
-	// Wasn't discovered in our links, append it.
-	if !exists {
-		bot.Links[channel.GuildID] = append(bot.Links[channel.GuildID], channel)
-	}
+	bot.Cache.SetChannel(channel)
+}
 
-	return
+// isPrivate checks if a channel is a direct or group message.
+func isPrivate(channel *discordgo.Channel) bool {
+	return channel.Type == discordgo.ChannelTypeDM || channel.Type == discordgo.ChannelTypeGroupDM
 }
 
-// GetGuildMembers returns EVERY user in a guild.
+// GetGuildMembers returns up to userAmount members of a guild.
 func (bot *Core) GetGuildMembers(guildID string, userAmount int) ([]*discordgo.Member, error) {
-	s := bot.Session
 	var usersAll []*discordgo.Member
+	if userAmount <= 0 {
+		return usersAll, nil
+	}
 
-	var pullAmount int
-	var afterID string
-
-	for userAmount > 0 {
-		pullAmount = userAmount
-		if userAmount > 1000 {
-			pullAmount = 1000
-		}
-
-		users, err := s.GuildMembers(guildID, afterID, pullAmount)
-		if err != nil {
-			return nil, err
-		}
-
-		// Add it to our list.
-		for _, u := range users {
-			afterID = u.User.ID
-			usersAll = append(usersAll, u)
-		}
-
-		userAmount -= pullAmount
+	err := bot.pageMembers(guildID, func(m *discordgo.Member) bool {
+		usersAll = append(usersAll, m)
+		return len(usersAll) < userAmount
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return usersAll, nil
@@ -0,0 +1,232 @@
+package godbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeDiscord answers REST requests made by a session, recording the
+// overwrites set and deleted. Requests in fail are answered with a 403 that
+// many times.
+type fakeDiscord struct {
+	mu       sync.Mutex
+	requests []string
+	fail     map[string]int // ["PUT id" or "DELETE id"] failures left
+}
+
+func (f *fakeDiscord) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := req.Method + " " + path.Base(req.URL.Path)
+	entry := key
+	if req.Method == http.MethodPut && req.Body != nil {
+		var body struct {
+			Allow int64 `json:"allow,string"`
+			Deny  int64 `json:"deny,string"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		entry = fmt.Sprintf("%s %d/%d", key, body.Allow, body.Deny)
+	}
+	f.requests = append(f.requests, entry)
+
+	resp := &http.Response{
+		StatusCode: http.StatusNoContent,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}
+	if f.fail[key] > 0 {
+		f.fail[key]--
+		resp.StatusCode = http.StatusForbidden
+		resp.Body = io.NopCloser(strings.NewReader(`{"code": 50013, "message": "Missing Permissions"}`))
+	}
+	return resp, nil
+}
+
+// take returns the requests made since the last call.
+func (f *fakeDiscord) take() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	requests := f.requests
+	f.requests = nil
+	return requests
+}
+
+func TestChannelLock(t *testing.T) {
+	const (
+		view   = discordgo.PermissionViewChannel
+		send   = discordgo.PermissionSendMessages
+		attach = discordgo.PermissionAttachFiles
+		deny   = LockDenyText
+	)
+
+	role := func(id string, allow, deny int64) *discordgo.PermissionOverwrite {
+		return &discordgo.PermissionOverwrite{ID: id, Type: discordgo.PermissionOverwriteTypeRole, Allow: allow, Deny: deny}
+	}
+	member := func(id string, allow, deny int64) *discordgo.PermissionOverwrite {
+		return &discordgo.PermissionOverwrite{ID: id, Type: discordgo.PermissionOverwriteTypeMember, Allow: allow, Deny: deny}
+	}
+	put := func(id string, allow, deny int64) string {
+		return fmt.Sprintf("PUT %s %d/%d", id, allow, deny)
+	}
+
+	type unlock struct {
+		requests []string
+		failed   bool
+	}
+
+	tests := []struct {
+		name       string
+		overwrites []*discordgo.PermissionOverwrite
+		profile    *LockProfile
+		fail       map[string]int
+		lock       []string // Requests made locking.
+		lockFailed bool
+		locked     bool     // Locked after ChannelLock.
+		unlocks    []unlock // ChannelUnlock calls while locked.
+	}{
+		{
+			name:    "adds a deny for @everyone and removes it",
+			lock:    []string{put("g", 0, deny)},
+			locked:  true,
+			unlocks: []unlock{{requests: []string{"DELETE g"}}},
+		},
+		{
+			name:       "denies on existing overwrites and restores them",
+			overwrites: []*discordgo.PermissionOverwrite{role("g", view, 0), member("u", send|view, 0)},
+			lock:       []string{put("g", view, deny), put("u", view, deny)},
+			locked:     true,
+			unlocks:    []unlock{{requests: []string{put("g", view, 0), put("u", send|view, 0)}}},
+		},
+		{
+			name:       "preserved members are left alone",
+			overwrites: []*discordgo.PermissionOverwrite{member("u", send, 0)},
+			profile:    &LockProfile{PreserveMembers: true},
+			lock:       []string{put("g", 0, deny)},
+			locked:     true,
+			unlocks:    []unlock{{requests: []string{put("u", send, 0), "DELETE g"}}},
+		},
+		{
+			name:       "no @everyone overwrite is added",
+			overwrites: []*discordgo.PermissionOverwrite{role("r1", 0, view)},
+			profile:    &LockProfile{NoEveryone: true, Deny: send},
+			lock:       []string{put("r1", 0, view|send)},
+			locked:     true,
+			unlocks:    []unlock{{requests: []string{put("r1", 0, view)}}},
+		},
+		{
+			name:    "exempt roles keep only what they had",
+			profile: &LockProfile{ExemptRoles: []string{"mod"}},
+			lock:    []string{put("g", 0, deny), put("mod", send|attach, 0)},
+			locked:  true,
+			unlocks: []unlock{{requests: []string{"DELETE g", "DELETE mod"}}},
+		},
+		{
+			name:       "exempt roles keep what their overwrite denies",
+			overwrites: []*discordgo.PermissionOverwrite{role("mod", 0, send), role("g", 0, attach)},
+			profile:    &LockProfile{ExemptRoles: []string{"mod"}},
+			lock:       []string{put("mod", 0, send), put("g", 0, deny)},
+			locked:     true,
+			unlocks:    []unlock{{requests: []string{put("mod", 0, send), put("g", 0, attach)}}},
+		},
+		{
+			name:       "exempt roles without the permissions get no overwrite",
+			overwrites: []*discordgo.PermissionOverwrite{role("g", 0, send)},
+			profile:    &LockProfile{ExemptRoles: []string{"r1"}, Deny: send},
+			lock:       []string{put("g", 0, send)},
+			locked:     true,
+			unlocks:    []unlock{{requests: []string{put("g", 0, send)}}},
+		},
+		{
+			name:       "a failed overwrite is rolled back",
+			overwrites: []*discordgo.PermissionOverwrite{role("r1", send, 0)},
+			fail:       map[string]int{"PUT r1": 1},
+			lock:       []string{put("r1", 0, deny), put("g", 0, deny), put("r1", send, 0), "DELETE g"},
+			lockFailed: true,
+		},
+		{
+			name:       "a failed rollback stays locked until unlocked",
+			overwrites: []*discordgo.PermissionOverwrite{role("r1", send, 0)},
+			fail:       map[string]int{"PUT r1": 2},
+			lock:       []string{put("r1", 0, deny), put("g", 0, deny), put("r1", send, 0), "DELETE g"},
+			lockFailed: true,
+			locked:     true,
+			unlocks:    []unlock{{requests: []string{put("r1", send, 0)}}},
+		},
+		{
+			name:   "a failed unlock can be retried",
+			fail:   map[string]int{"DELETE g": 1},
+			lock:   []string{put("g", 0, deny)},
+			locked: true,
+			unlocks: []unlock{
+				{requests: []string{"DELETE g"}, failed: true},
+				{requests: []string{"DELETE g"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeDiscord{fail: tt.fail}
+			s, _ := discordgo.New("Bot token")
+			s.Client = &http.Client{Transport: fake}
+
+			bot := &Core{Session: s, Cache: NewMemoryCache()}
+			bot.Cache.SetGuild(&discordgo.Guild{ID: "g", Roles: []*discordgo.Role{
+				{ID: "g", Permissions: view | send},
+				{ID: "r1"},
+				{ID: "mod", Permissions: attach},
+			}})
+			bot.Cache.SetChannel(&discordgo.Channel{
+				ID: "c", GuildID: "g", Type: discordgo.ChannelTypeGuildText, PermissionOverwrites: tt.overwrites,
+			})
+
+			cl, err := bot.ChannelLockCreate("c")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cl.Profile = tt.profile
+
+			err = cl.ChannelLock(false)
+			var lerr *LockError
+			if failed := errors.As(err, &lerr); failed != tt.lockFailed {
+				t.Fatalf("lock error %v, want failure %t", err, tt.lockFailed)
+			}
+			if got := fake.take(); !reflect.DeepEqual(got, tt.lock) {
+				t.Errorf("locking made %q, want %q", got, tt.lock)
+			}
+			if cl.Locked != tt.locked || (bot.ActiveLock("c") != nil) != tt.locked {
+				t.Fatalf("locked %t, want %t", cl.Locked, tt.locked)
+			}
+
+			for n, u := range tt.unlocks {
+				err := cl.ChannelUnlock()
+				if failed := errors.As(err, &lerr); failed != u.failed {
+					t.Errorf("unlock %d: error %v, want failure %t", n, err, u.failed)
+				}
+				if got := fake.take(); !reflect.DeepEqual(got, u.requests) {
+					t.Errorf("unlock %d: made %q, want %q", n, got, u.requests)
+				}
+			}
+			if cl.Locked || bot.ActiveLock("c") != nil {
+				t.Errorf("still locked")
+			}
+			if err := cl.ChannelUnlock(); err != ErrChannelNotLocked {
+				t.Errorf("unlocking again: %v", err)
+			}
+		})
+	}
+}